@@ -0,0 +1,219 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Admin cache inspection and administration as a mountable http.Handler,
+// serving JSON on the paths relative to its mount point:
+//	GET /keys?prefix=&limit= lists keys by prefix
+//	GET /key?key= shows the decoded payload of key
+//	DELETE /key?key= deletes key
+//	POST /clear clears the cache
+//	GET /stats shows cache and pool stats
+type Admin struct {
+	// Cache adapter, listing keys requires KeysCache
+	Cache Cache
+
+	// Pool optional worker pool to show stats
+	Pool *Pool
+
+	// Limit default maximum number of keys listed
+	Limit int
+}
+
+// NewAdmin creates cache admin handler of the cache adapter,
+// mount with http.StripPrefix under its path
+func NewAdmin(c Cache) *Admin {
+	return &Admin{
+		Cache: c,
+		Limit: 1000,
+	}
+}
+
+// payloadInfo decoded payload of a cache entry
+type payloadInfo struct {
+	Key          string      `json:"key"`
+	Size         int         `json:"size"`
+	TTL          string      `json:"ttl,omitempty"`
+	Decoded      bool        `json:"decoded"`
+	Version      int         `json:"version,omitempty"`
+	Codec        byte        `json:"codec,omitempty"`
+	BestBefore   *time.Time  `json:"best_before,omitempty"`
+	StaleUntil   *time.Time  `json:"stale_until,omitempty"`
+	StaleIfError *time.Time  `json:"stale_if_error,omitempty"`
+	Created      *time.Time  `json:"created,omitempty"`
+	StatusCode   int         `json:"status_code,omitempty"`
+	Header       http.Header `json:"header,omitempty"`
+	Vary         []string    `json:"vary,omitempty"`
+	ValueSize    int         `json:"value_size"`
+}
+
+// ServeHTTP implements http.Handler
+func (a *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/keys", "keys":
+		a.allow(w, r, a.keys, http.MethodGet)
+	case "/key", "key":
+		a.allow(w, r, a.key, http.MethodGet, http.MethodDelete)
+	case "/clear", "clear":
+		a.allow(w, r, a.clear, http.MethodPost)
+	case "/stats", "stats":
+		a.allow(w, r, a.stats, http.MethodGet)
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+func (a *Admin) allow(
+	w http.ResponseWriter, r *http.Request,
+	fn func(http.ResponseWriter, *http.Request), methods ...string,
+) {
+	for _, method := range methods {
+		if r.Method == method {
+			fn(w, r)
+			return
+		}
+	}
+	for _, method := range methods {
+		w.Header().Add("Allow", method)
+	}
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+}
+
+func (a *Admin) keys(w http.ResponseWriter, r *http.Request) {
+	kc, ok := a.Cache.(KeysCache)
+	if !ok {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "listing keys not supported"})
+		return
+	}
+	limit := a.Limit
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = n
+	}
+	keys, err := kc.Keys(r.Context(), r.URL.Query().Get("prefix"), limit)
+	if err == ErrNotSupported {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "listing keys not supported"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (a *Admin) key(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		c   = WithContext(a.Cache)
+		key = r.URL.Query().Get("key")
+	)
+	if key == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "key query parameter required"})
+		return
+	}
+	if r.Method == http.MethodDelete {
+		if err := c.DelContext(ctx, key); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+	b, ttl, err := c.FetchContext(ctx, key)
+	if err == ErrNotFound {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	} else if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	info := payloadInfo{Key: key, Size: len(b)}
+	if ttl > 0 {
+		info.TTL = ttl.String()
+	}
+	if p, err := parse(b, nil); err == nil {
+		info.Decoded = true
+		info.Version = p.V
+		info.Codec = p.Codec
+		info.BestBefore = timePtr(p.BestBefore)
+		info.StaleUntil = timePtr(p.StaleUntil)
+		info.StaleIfError = timePtr(p.StaleIfError)
+		info.Created = timePtr(p.Created)
+		info.StatusCode = p.StatusCode
+		info.Header = p.Header
+		info.Vary = p.Vary
+		info.ValueSize = len(p.Value)
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *Admin) clear(w http.ResponseWriter, _ *http.Request) {
+	if err := a.Cache.Clear(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (a *Admin) stats(w http.ResponseWriter, _ *http.Request) {
+	res := map[string]interface{}{"cache": cacheStats(a.Cache)}
+	if a.Pool != nil {
+		res["pool"] = a.Pool.Stats()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// cacheStats returns stats of the cache adapter
+func cacheStats(c Cache) map[string]interface{} {
+	switch c := c.(type) {
+	case *Hybrid:
+		return map[string]interface{}{
+			"type":       "hybrid",
+			"upstream":   cacheStats(c.Upstream),
+			"downstream": cacheStats(c.Downstream),
+		}
+	case *Memory:
+		c.mu.Lock()
+		keys := len(c.keys)
+		c.mu.Unlock()
+		stats := map[string]interface{}{
+			"type":    "memory",
+			"keys":    keys,
+			"max_ttl": c.MaxTTL.String(),
+		}
+		if m := c.Cache.Metrics; m != nil {
+			stats["hits"] = m.Hits()
+			stats["misses"] = m.Misses()
+			stats["keys_added"] = m.KeysAdded()
+			stats["keys_evicted"] = m.KeysEvicted()
+			stats["cost_added"] = m.CostAdded()
+			stats["cost_evicted"] = m.CostEvicted()
+		}
+		return stats
+	case *Redis:
+		pool := c.Pool.Stats()
+		return map[string]interface{}{
+			"type":          "redis",
+			"prefix":        c.Prefix,
+			"active_conns":  pool.ActiveCount,
+			"idle_conns":    pool.IdleCount,
+			"wait_count":    pool.WaitCount,
+			"wait_duration": pool.WaitDuration.String(),
+		}
+	}
+	return map[string]interface{}{"type": "unknown"}
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
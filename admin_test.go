@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemory_Keys(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(10, int64(10<<20), -1)
+	for _, key := range []string{"a/2", "a/1", "b/1", "expire"} {
+		ttl := time.Hour
+		if key == "expire" {
+			ttl = time.Millisecond
+		}
+		if err := c.Set(key, []byte(key), ttl); err != nil {
+			t.Error(err)
+		}
+	}
+	time.Sleep(time.Millisecond * 10)
+	if keys, err := c.Keys(ctx, "a/", 0); err != nil || !reflect.DeepEqual(keys, []string{"a/1", "a/2"}) {
+		t.Error(keys, err, "should list keys by prefix")
+	}
+	if keys, err := c.Keys(ctx, "", 2); err != nil || len(keys) != 2 {
+		t.Error(keys, err, "should limit keys")
+	}
+	if err := c.DelPrefix(ctx, "a/"); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.Get("a/1"); err != ErrNotFound {
+		t.Error(err, "should delete by prefix")
+	}
+	if v, err := c.Get("b/1"); err != nil || string(v) != "b/1" {
+		t.Error(v, err, "should keep keys of other prefix")
+	}
+	if err := c.Clear(); err != nil {
+		t.Error(err)
+	}
+	if keys, err := c.Keys(ctx, "", 0); err != nil || len(keys) != 0 {
+		t.Error(keys, err, "should clear keys")
+	}
+	_ = c.Set("dropped", []byte("dropped"), -time.Second)
+	if keys, err := c.Keys(ctx, "", 0); err != nil || len(keys) != 0 {
+		t.Error(keys, err, "should not index dropped set")
+	}
+	for i := 0; i < 200; i++ {
+		_ = c.Set(strconv.Itoa(i), []byte("a"), time.Hour)
+	}
+	if keys, err := c.Keys(ctx, "", 0); err != nil || len(keys) > 100 {
+		t.Error(len(keys), err, "should bound key index")
+	}
+	if keys, err := (&Redis{KeyFunc: SafeKey(100)}).Keys(ctx, "", 0); err != ErrNotSupported {
+		t.Error(keys, err, "should not list keys transformed by KeyFunc")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	c := NewMemory(10, int64(10<<20), -1)
+	h := NewHTTP(c, time.Second, time.Minute, time.Hour)
+	cached := h.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "bar")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	for _, url := range []string{"/a/1", "/a/2", "/b/1"} {
+		cached.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+	_ = c.Set("raw", []byte("raw"), time.Hour)
+	time.Sleep(time.Millisecond * 10)
+
+	admin := http.StripPrefix("/admin", NewAdmin(c))
+	do := func(method, target string, v interface{}) int {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		if v != nil {
+			if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+				t.Error(err)
+			}
+		}
+		return w.Code
+	}
+	var keys struct{ Keys []string }
+	if code := do("GET", "/admin/keys?prefix=/a/", &keys); code != http.StatusOK ||
+		!reflect.DeepEqual(keys.Keys, []string{"/a/1", "/a/2"}) {
+		t.Error(code, keys, "should list keys")
+	}
+	var info payloadInfo
+	if code := do("GET", "/admin/key?key=/a/1", &info); code != http.StatusOK ||
+		!info.Decoded || info.StatusCode != http.StatusOK || info.Header.Get("X-Foo") != "bar" ||
+		info.ValueSize != 5 || info.BestBefore == nil || info.TTL == "" {
+		t.Error(code, info, "should decode payload")
+	}
+	info = payloadInfo{}
+	if code := do("GET", "/admin/key?key=raw", &info); code != http.StatusOK || info.Decoded || info.Size != 3 {
+		t.Error(code, info, "should show undecodable value")
+	}
+	if code := do("DELETE", "/admin/key?key=/a/1", nil); code != http.StatusOK {
+		t.Error(code, "should delete key")
+	}
+	if code := do("GET", "/admin/key?key=/a/1", nil); code != http.StatusNotFound {
+		t.Error(code, "should not found deleted key")
+	}
+	var stats struct{ Cache map[string]interface{} }
+	if code := do("GET", "/admin/stats", &stats); code != http.StatusOK ||
+		stats.Cache["type"] != "memory" || stats.Cache["keys"] != float64(3) {
+		t.Error(code, stats, "should show stats")
+	}
+	if code := do("GET", "/admin/clear", nil); code != http.StatusMethodNotAllowed {
+		t.Error(code, "should not clear with GET")
+	}
+	if code := do("POST", "/admin/clear", nil); code != http.StatusOK {
+		t.Error(code, "should clear")
+	}
+	if code := do("GET", "/admin/keys", &keys); code != http.StatusOK || len(keys.Keys) != 0 {
+		t.Error(code, keys, "should be cleared")
+	}
+	if code := do("GET", "/admin/"+strings.Repeat("x", 3), nil); code != http.StatusNotFound {
+		t.Error(code, "should not found")
+	}
+}
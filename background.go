@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// background tracks in-flight background refreshes and writes for graceful shutdown.
+// A nil background runs work untracked
+type background struct {
+	// mu read locked by tracking work, so that adding work on the hot path does not contend
+	mu     sync.RWMutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// cacheBackgrounds backgrounds of Func and HTTP not created by their constructors,
+// shared by the work on the same cache adapter
+var cacheBackgrounds sync.Map
+
+// cacheBackground returns background of cache adapter,
+// or nil if the adapter can not be tracked by value
+func cacheBackground(c Cache) *background {
+	if c == nil || !reflect.TypeOf(c).Comparable() {
+		return nil
+	}
+	b, _ := cacheBackgrounds.LoadOrStore(c, &background{})
+	return b.(*background)
+}
+
+func (b *background) add() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return false
+	}
+	b.wg.Add(1)
+	return true
+}
+
+func (b *background) done() {
+	if b != nil {
+		b.wg.Done()
+	}
+}
+
+// Go runs fn in goroutine, returns false if already shut down
+func (b *background) Go(fn func()) bool {
+	if !b.add() {
+		return false
+	}
+	go func() {
+		defer b.done()
+		fn()
+	}()
+	return true
+}
+
+// Submit runs fn keyed by key on pool if not nil,
+// otherwise in goroutine. Returns false if fn will not be run
+func (b *background) Submit(pool *Pool, key string, fn func()) bool {
+	if pool == nil {
+		return b.Go(fn)
+	}
+	if !b.add() {
+		return false
+	}
+	// evicted submission never runs, release its tracking
+	if !pool.submit(key, func() {
+		defer b.done()
+		fn()
+	}, b.done) {
+		b.done()
+		return false
+	}
+	return true
+}
+
+// Shutdown stops accepting new work and waits for the in-flight ones
+// until context done
+func (b *background) Shutdown(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	ch := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFunc_Shutdown(t *testing.T) {
+	var (
+		c        = NewHybrid(NewMemory(10, int64(10<<20), -1), NewMemory(10, int64(10<<20), -1))
+		fn       = NewFunc(c, time.Second, time.Millisecond*10, time.Second)
+		ctx      = context.Background()
+		finished int32
+		val      string
+	)
+	call := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		atomic.AddInt32(&finished, 1)
+		return "a", nil
+	}
+	if err := fn.Do(ctx, "a", call, &val); err != nil || val != "a" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	if err := fn.Do(ctx, "a", call, &val); err != nil || val != "a" {
+		t.Error(val, err, "should serve stale and refresh")
+	}
+	if err := fn.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&finished); n != 2 {
+		t.Errorf(" = %v, want %v, should drain in-flight refresh", n, 2)
+	}
+	if _, err := c.Get("a"); err != ErrShutdown {
+		t.Errorf(" = %v, want %v", err, ErrShutdown)
+	}
+}
+
+func TestFunc_Shutdown_Deadline(t *testing.T) {
+	var (
+		c   = NewMemory(10, int64(10<<20), -1)
+		fn  = NewFunc(c, time.Second, time.Millisecond*10, time.Second)
+		val string
+	)
+	call := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 100)
+		return "a", nil
+	}
+	if err := fn.Do(context.Background(), "a", call, &val); err != nil || val != "a" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	_ = fn.Do(context.Background(), "a", call, &val)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := fn.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf(" = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if ok := fn.bg.Go(func() {}); ok {
+		t.Error("should not accept work after shutdown")
+	}
+}
+
+func TestBackground_DropOldest(t *testing.T) {
+	var (
+		bg      = &background{}
+		p       = NewPool(1, 1)
+		release = make(chan struct{})
+	)
+	p.Overflow = DropOldest
+	bg.Submit(p, "a", func() { <-release })
+	time.Sleep(time.Millisecond * 10)
+	bg.Submit(p, "b", func() {})
+	bg.Submit(p, "c", func() {})
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := bg.Shutdown(ctx); err != nil {
+		t.Errorf(" = %v, dropped submission should not be waited for", err)
+	}
+	p.Close()
+}
+
+func TestHTTP_Shutdown_Deadline(t *testing.T) {
+	c := NewMemory(10, int64(10<<20), -1)
+	h := NewHTTP(c, time.Second, time.Minute, time.Hour)
+	done := make(chan struct{})
+	h.bg.Go(func() {
+		<-done
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf(" = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := c.Set("a", []byte("a"), time.Minute); err != nil {
+		t.Errorf(" = %v, cache should stay open for work in flight", err)
+	}
+	close(done)
+}
+
+func TestFunc_Shutdown_Literal(t *testing.T) {
+	var (
+		c        = NewHybrid(NewMemory(10, int64(10<<20), -1), NewMemory(10, int64(10<<20), -1))
+		fn       = Func{Cache: c, WaitFor: time.Second, FreshFor: time.Millisecond * 10, TTL: time.Second}
+		ctx      = context.Background()
+		finished int32
+		val      string
+	)
+	call := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 50)
+		atomic.AddInt32(&finished, 1)
+		return "a", nil
+	}
+	if err := fn.Do(ctx, "a", call, &val); err != nil || val != "a" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	if err := fn.Do(ctx, "a", call, &val); err != nil || val != "a" {
+		t.Error(val, err, "should serve stale and refresh")
+	}
+	if err := fn.Shutdown(ctx); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&finished); n != 2 {
+		t.Errorf(" = %v, want %v, Func literal should drain in-flight refresh", n, 2)
+	}
+}
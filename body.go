@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultMaxRequestBody default size limit of POST request body for cache key
+const defaultMaxRequestBody = 1 << 20
+
+// cacheRequest returns HTTP handling the request and its cache key,
+// and the body of POST request accepted by AcceptPost,
+// or false if request should not be handled. The returned request has its body restored
+func (h HTTP) cacheRequest(r *http.Request) (_ HTTP, _ *http.Request, key string, body []byte, ok bool) {
+	if r.Method == http.MethodPost && h.AcceptPost != nil {
+		if !h.AcceptPost(r) {
+			return h, r, "", nil, false
+		}
+		limit := h.MaxRequestBody
+		if limit <= 0 {
+			limit = defaultMaxRequestBody
+		}
+		if r, body, ok = readBody(r, limit); !ok {
+			return h, r, "", nil, false
+		}
+		key = derivedKey(h.requestKey(r), "post", hashBody(r.Header.Get("Content-Type"), body))
+	} else if h.AcceptRequest != nil && !h.AcceptRequest(r) {
+		return h, r, "", nil, false
+	} else {
+		key = h.requestKey(r)
+	}
+	if !h.ShareCredentials && hasCredentials(r) {
+		if h, key, ok = h.privateRequest(r, key); !ok {
+			return h, r, "", nil, false
+		}
+	}
+	return h, r, key, body, true
+}
+
+// readBody reads request body up to limit bytes,
+// returns request with the body restored for the next reader
+func readBody(r *http.Request, limit int64) (*http.Request, []byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, []byte{}, true
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	rr := new(http.Request)
+	*rr = *r
+	rr.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	if err != nil || int64(len(b)) > limit {
+		return rr, nil, false
+	}
+	return withBody(rr, b), b, true
+}
+
+// withBody returns request with a fresh reader of body
+func withBody(r *http.Request, body []byte) *http.Request {
+	if body == nil {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return r
+}
+
+// hashBody returns hex sha256 of the media type and normalized body
+func hashBody(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	h := sha256.New()
+	_, _ = h.Write([]byte(mediaType + "\n"))
+	_, _ = h.Write(normalizeBody(mediaType, body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeBody returns body of JSON compacted with sorted object keys,
+// or form with sorted fields, so that equivalent requests share a cache key
+func normalizeBody(mediaType string, body []byte) []byte {
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return body
+		}
+		if _, err := d.Token(); err != io.EOF {
+			return body
+		}
+		if b, err := json.Marshal(v); err == nil {
+			return b
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return []byte(values.Encode())
+		}
+	}
+	return body
+}
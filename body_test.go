@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTP_AcceptPost(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.Method + " " + strconv.Itoa(counter) + " " + string(body)))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.AcceptPost = func(r *http.Request) bool {
+		return r.URL.Path == "/graphql"
+	}
+	h.MaxRequestBody = 64
+	c := *h
+	c.Cache = NewMemory(10, int64(10<<20), -1)
+	handlers := map[string]http.Handler{
+		"Handler":      h.Handler(handler),
+		"RoundTripper": roundTripHandler{c.RoundTripper(roundTripper{Handler: handler})},
+	}
+	for name, cached := range handlers {
+		counter = 0
+		t.Run(name, func(t *testing.T) {
+			do := func(path, contentType, body string) string {
+				r := httptest.NewRequest(http.MethodPost, "http://foo.bar"+path, strings.NewReader(body))
+				r.Header.Set("Content-Type", contentType)
+				w := httptest.NewRecorder()
+				cached.ServeHTTP(w, r)
+				time.Sleep(time.Millisecond * 10)
+				return w.Body.String()
+			}
+			tests := []struct {
+				name        string
+				path        string
+				contentType string
+				body        string
+				want        string
+			}{
+				{"miss", "/graphql", "application/json", `{"query":"a","variables":{"x":1,"y":2}}`,
+					`POST 1 {"query":"a","variables":{"x":1,"y":2}}`},
+				{"normalized json", "/graphql", "application/json; charset=utf-8",
+					"{\n  \"variables\": {\"y\": 2, \"x\": 1},\n  \"query\": \"a\"\n}",
+					`POST 1 {"query":"a","variables":{"x":1,"y":2}}`},
+				{"other body", "/graphql", "application/json", `{"query":"b"}`, `POST 2 {"query":"b"}`},
+				{"other content type", "/graphql", "text/plain", `{"query":"b"}`, `POST 3 {"query":"b"}`},
+				{"normalized form", "/graphql", "application/x-www-form-urlencoded", "b=2&a=1", "POST 4 b=2&a=1"},
+				{"form hit", "/graphql", "application/x-www-form-urlencoded", "a=1&b=2", "POST 4 b=2&a=1"},
+				{"too large", "/graphql", "text/plain", strings.Repeat("x", 65),
+					"POST 5 " + strings.Repeat("x", 65)},
+				{"too large again", "/graphql", "text/plain", strings.Repeat("x", 65),
+					"POST 6 " + strings.Repeat("x", 65)},
+				{"not accepted", "/other", "text/plain", "foo", "POST 7 foo"},
+				{"not accepted again", "/other", "text/plain", "foo", "POST 8 foo"},
+			}
+			for _, tt := range tests {
+				if got := do(tt.path, tt.contentType, tt.body); got != tt.want {
+					t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTP_AcceptPost_Refresh(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		_, _ = w.Write(body)
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Millisecond*10, time.Hour)
+	h.AcceptPost = func(*http.Request) bool { return true }
+	do := func() string {
+		w := httptest.NewRecorder()
+		h.Handler(handler).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://foo.bar/", strings.NewReader("q")))
+		time.Sleep(time.Millisecond * 20)
+		return w.Body.String()
+	}
+	do()
+	if got := do(); got != "q" {
+		t.Errorf(" = %v, want %v", got, "q")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || bodies[1] != "q" {
+		t.Errorf("bodies = %q, background refresh should send the request body", bodies)
+	}
+}
+
+func TestHTTP_AcceptPost_KeyCollision(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Method))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.AcceptPost = func(*http.Request) bool { return true }
+	do := func(method, query, body string) string {
+		r := httptest.NewRequest(method, "http://foo.bar/graphql", strings.NewReader(body))
+		// servers keep a raw # of request URI in the query
+		r.URL.RawQuery = query
+		w := httptest.NewRecorder()
+		h.Handler(handler).ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	do(http.MethodGet, "op=x#post:"+hashBody("", []byte("q")), "")
+	if got := do(http.MethodPost, "op=x", "q"); got != http.MethodPost {
+		t.Errorf(" = %v, want %v, POST key should not collide with request key", got, http.MethodPost)
+	}
+}
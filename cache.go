@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"errors"
 	"time"
 )
@@ -32,9 +33,133 @@ type Cache interface {
 	Race(key string, fn func() ([]byte, error), waitFor, ttl time.Duration) ([]byte, error)
 }
 
+// ContextCache interface for context aware cache adaptor,
+// where calls can be cancelled and carry context values
+type ContextCache interface {
+	Cache
+
+	// GetContext value by key that prioritize quick access over freshness
+	GetContext(ctx context.Context, key string) (value []byte, err error)
+
+	// FetchContext the freshest value with its remaining ttl by key
+	FetchContext(ctx context.Context, key string) (value []byte, ttl time.Duration, err error)
+
+	// SetContext value and ttl by key
+	SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// DelContext deletes items from the cache by keys
+	DelContext(ctx context.Context, keys ...string) error
+
+	// RaceContext executes and returns the given function once
+	// under specified timeout, suppressing multiple calls of the same key.
+	// Waiting for the result is cancelled when context done
+	RaceContext(
+		ctx context.Context, key string, fn func() ([]byte, error), waitFor, ttl time.Duration,
+	) ([]byte, error)
+}
+
+// PrefixCache interface for cache adaptor that deletes items by key prefix
+type PrefixCache interface {
+	// DelPrefix deletes items from the cache with keys of prefix
+	DelPrefix(ctx context.Context, prefix string) error
+}
+
+// IndexCache interface for cache adaptor that updates index entries atomically,
+// an index entry is a set of keys sharing a label
+type IndexCache interface {
+	// AddIndex adds keys into index entry, extending its ttl if needed
+	AddIndex(ctx context.Context, index string, ttl time.Duration, keys ...string) error
+
+	// IndexKeys returns keys of index entry
+	IndexKeys(ctx context.Context, index string) ([]string, error)
+}
+
+// KeysCache interface for cache adaptor that lists keys
+type KeysCache interface {
+	// Keys returns sorted keys of prefix up to limit, no limit if limit <= 0
+	Keys(ctx context.Context, prefix string, limit int) ([]string, error)
+}
+
+// WithContext returns ContextCache of the cache adaptor,
+// wraps it if it only implements Cache interface
+func WithContext(c Cache) ContextCache {
+	if cc, ok := c.(ContextCache); ok {
+		return cc
+	}
+	return contextCache{c}
+}
+
+// contextCache wraps Cache into ContextCache,
+// checking context before each call
+type contextCache struct {
+	Cache
+}
+
+func (c contextCache) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+func (c contextCache) FetchContext(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return c.Fetch(key)
+}
+
+func (c contextCache) SetContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Set(key, value, ttl)
+}
+
+func (c contextCache) DelContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Del(keys...)
+}
+
+func (c contextCache) RaceContext(
+	ctx context.Context, key string, fn func() ([]byte, error), waitFor, ttl time.Duration,
+) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Race(key, fn, waitFor, ttl)
+}
+
+// shutdown gracefully shuts down cache if supported, otherwise close
+func shutdown(ctx context.Context, c Cache) error {
+	if s, ok := c.(interface {
+		Shutdown(context.Context) error
+	}); ok {
+		return s.Shutdown(ctx)
+	}
+	return c.Close()
+}
+
+// delPrefix deletes items with keys of prefix if supported by cache,
+// otherwise returns ErrNotSupported
+func delPrefix(ctx context.Context, c Cache, prefix string) error {
+	if pc, ok := c.(PrefixCache); ok {
+		return pc.DelPrefix(ctx, prefix)
+	}
+	return ErrNotSupported
+}
+
 // ErrNotFound result not found
 var ErrNotFound = errors.New("hybridcache: not found")
 
 // ErrNoCache denotes result should not be cached,
 // does not result an error to the endpoint
 var ErrNoCache = errors.New("hybridcache: no cache")
+
+// ErrShutdown denotes the cache has been shut down
+var ErrShutdown = errors.New("hybridcache: shut down")
+
+// ErrNotSupported denotes the operation is not supported by the cache adaptor
+var ErrNotSupported = errors.New("hybridcache: not supported")
@@ -184,3 +184,66 @@ func DoTestCacheRace(name string, t *testing.T, c Cache, m, n int, sleep time.Du
 		}
 	})
 }
+
+type legacyCache struct {
+	Cache
+}
+
+func TestWithContext(t *testing.T) {
+	DoTestCacheContext("Memory", t, NewMemory(10, int64(10<<20), -1))
+	DoTestCacheContext("HybridMemory", t, NewHybrid(
+		NewMemory(10, int64(10<<20), time.Minute*1),
+		NewMemory(10, int64(10<<20), time.Minute*1),
+	))
+	DoTestCacheContext("Legacy", t, legacyCache{NewMemory(10, int64(10<<20), -1)})
+}
+
+func DoTestCacheContext(name string, t *testing.T, cache Cache) {
+	t.Run(name+"TestContext", func(t *testing.T) {
+		c := WithContext(cache)
+		ctx := context.Background()
+		if err := c.SetContext(ctx, "a", []byte("b"), time.Second); err != nil {
+			t.Error(err)
+		}
+		time.Sleep(time.Millisecond)
+		if v, err := c.GetContext(ctx, "a"); string(v) != "b" || err != nil {
+			t.Error(err, "should value and no error")
+		}
+		if v, ttl, err := c.FetchContext(ctx, "a"); string(v) != "b" || ttl <= 0 || err != nil {
+			t.Error(err, "should value, ttl and no error")
+		}
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if _, err := c.GetContext(cancelled, "a"); err != context.Canceled {
+			t.Errorf(" = %v, want %v", err, context.Canceled)
+		}
+		if err := c.DelContext(ctx, "a"); err != nil {
+			t.Error(err)
+		}
+		time.Sleep(time.Millisecond)
+		if v, err := c.GetContext(ctx, "a"); v != nil || err != ErrNotFound {
+			t.Error(err, "should value nil and err not found")
+		}
+		go func() {
+			_, _ = c.RaceContext(ctx, "r", func() ([]byte, error) {
+				time.Sleep(time.Millisecond * 100)
+				return []byte("r"), nil
+			}, time.Second, time.Second)
+		}()
+		time.Sleep(time.Millisecond * 10)
+		timeout, cancel2 := context.WithTimeout(ctx, time.Millisecond*10)
+		defer cancel2()
+		if _, isLegacy := cache.(legacyCache); !isLegacy {
+			if _, err := c.RaceContext(timeout, "r", func() ([]byte, error) {
+				t.Error("should suppress")
+				return nil, nil
+			}, time.Second, time.Second); err != context.DeadlineExceeded {
+				t.Errorf(" = %v, want %v", err, context.DeadlineExceeded)
+			}
+		}
+		time.Sleep(time.Millisecond * 100)
+		if err := c.Close(); err != nil {
+			t.Error(err, "error closing cache")
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl parsed Cache-Control directives by lowercase name
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := directive, ""
+			if i := strings.IndexByte(directive, '='); i >= 0 {
+				name, arg = directive[:i], strings.Trim(strings.TrimSpace(directive[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = arg
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// duration returns delta-seconds argument of directive
+func (cc cacheControl) duration(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec) * time.Second, true
+}
+
+// applyCacheControl sets freshness and stale windows of payload
+// from the origin response headers according to RFC 9111,
+// returns ErrNoCache if response should not be stored
+func (h HTTP) applyCacheControl(p *payload, header http.Header) error {
+	cc := parseCacheControl(header)
+	if cc.has("no-store") || cc.has("private") && !h.private {
+		return ErrNoCache
+	}
+	var (
+		now        = time.Now()
+		freshFor   = h.FreshFor
+		staleFor   time.Duration
+		errorFor   time.Duration
+		explicit   bool
+		revalidate = cc.has("must-revalidate") || cc.has("proxy-revalidate")
+	)
+	if d, ok := cc.duration("s-maxage"); ok && !h.private {
+		// shared cache directive, not applicable to private entries
+		freshFor, explicit, revalidate = d, true, true
+	} else if d, ok := cc.duration("max-age"); ok {
+		freshFor, explicit = d, true
+	} else if expires := header.Get("Expires"); expires != "" {
+		explicit = true
+		freshFor = 0
+		if t, err := http.ParseTime(expires); err == nil {
+			date := now
+			if d, err := http.ParseTime(header.Get("Date")); err == nil {
+				date = d
+			}
+			freshFor = t.Sub(date)
+		}
+	}
+	if explicit {
+		if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+			freshFor -= time.Duration(age) * time.Second
+		}
+	}
+	if freshFor < 0 || cc.has("no-cache") {
+		freshFor = 0
+	}
+	if !revalidate {
+		staleFor, _ = cc.duration("stale-while-revalidate")
+		errorFor, _ = cc.duration("stale-if-error")
+	}
+	if cc.has("no-cache") {
+		staleFor = 0
+	}
+	p.BestBefore = now.Add(freshFor)
+	p.StaleUntil = p.BestBefore.Add(staleFor)
+	p.StaleIfError = p.BestBefore.Add(errorFor)
+	p.ttl = h.TTL
+	if window := freshFor + maxDuration(staleFor, errorFor); window > p.ttl {
+		p.ttl = window
+	}
+	return nil
+}
+
+// errOnlyIfCached response not found in cache for request with only-if-cached
+var errOnlyIfCached = errors.New("hybridcache: only-if-cached response not found")
+
+// requestDirectives client Cache-Control directives of request,
+// negative durations for directives not present
+type requestDirectives struct {
+	noCache      bool
+	onlyIfCached bool
+	maxAge       time.Duration
+	maxStale     time.Duration
+	minFresh     time.Duration
+}
+
+// requestDirectives returns the client Cache-Control directives of request,
+// or nil if request directives are not accepted or not present
+func (h HTTP) requestDirectives(r *http.Request) *requestDirectives {
+	if h.AcceptRequestCacheControl == nil || !h.AcceptRequestCacheControl(r) {
+		return nil
+	}
+	cc := parseCacheControl(r.Header)
+	if len(cc) == 0 {
+		if r.Header.Get("Pragma") != "no-cache" {
+			return nil
+		}
+		cc["no-cache"] = ""
+	}
+	d := &requestDirectives{
+		noCache:      cc.has("no-cache"),
+		onlyIfCached: cc.has("only-if-cached"),
+		maxAge:       -1,
+		maxStale:     -1,
+		minFresh:     -1,
+	}
+	if v, ok := cc.duration("max-age"); ok {
+		d.maxAge = v
+	}
+	if v, ok := cc.duration("min-fresh"); ok {
+		d.minFresh = v
+	}
+	if v, ok := cc.duration("max-stale"); ok {
+		d.maxStale = v
+	} else if cc.has("max-stale") && cc["max-stale"] == "" {
+		// max-stale without value accepts stale response of any age
+		d.maxStale = math.MaxInt64
+	}
+	return d
+}
+
+// acceptable returns if the cached payload satisfies request directives,
+// otherwise it should be revalidated before serving
+func (d *requestDirectives) acceptable(p *payload) bool {
+	now := time.Now()
+	if d.noCache {
+		return false
+	}
+	if d.maxAge >= 0 && (p.Created.IsZero() || now.Sub(p.Created) > d.maxAge) {
+		return false
+	}
+	if d.minFresh >= 0 && p.BestBefore.Sub(now) < d.minFresh {
+		return false
+	}
+	if d.maxStale >= 0 && p.NeedRefresh() && now.Sub(p.BestBefore) > d.maxStale {
+		return false
+	}
+	return true
+}
+
+// servable returns if the cached payload can be served without contacting origin,
+// satisfying request directives, and either fresh, within its stale window
+// or accepted stale by max-stale
+func (d *requestDirectives) servable(p *payload) bool {
+	if !d.acceptable(p) {
+		return false
+	}
+	return !p.NeedRefresh() || p.CanServeStale() || d.maxStale >= 0
+}
+
+// isServerError returns if status code is an error that stale-if-error applies
+func isServerError(code int) bool {
+	switch code {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
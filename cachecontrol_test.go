@@ -0,0 +1,283 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHTTP_applyCacheControl(t *testing.T) {
+	h := NewHTTP(nil, time.Second, time.Minute, time.Hour)
+	now := time.Now()
+	tests := []struct {
+		name     string
+		header   http.Header
+		wantErr  error
+		freshFor time.Duration
+		staleFor time.Duration
+		errorFor time.Duration
+		wantTTL  time.Duration
+	}{
+		{
+			name:     "default fresh for without directives",
+			header:   http.Header{},
+			freshFor: time.Minute,
+			wantTTL:  time.Hour,
+		},
+		{
+			name:    "no-store should not cache",
+			header:  http.Header{"Cache-Control": {"public, no-store"}},
+			wantErr: ErrNoCache,
+		},
+		{
+			name:    "private should not cache",
+			header:  http.Header{"Cache-Control": {"Private"}},
+			wantErr: ErrNoCache,
+		},
+		{
+			name:     "max-age with stale directives",
+			header:   http.Header{"Cache-Control": {"max-age=30", "stale-while-revalidate=10, stale-if-error=\"7200\""}},
+			freshFor: time.Second * 30,
+			staleFor: time.Second * 10,
+			errorFor: time.Hour * 2,
+			wantTTL:  time.Second*30 + time.Hour*2,
+		},
+		{
+			name:     "s-maxage over max-age",
+			header:   http.Header{"Cache-Control": {"max-age=30, s-maxage=60, stale-while-revalidate=10"}},
+			freshFor: time.Minute,
+			wantTTL:  time.Hour,
+		},
+		{
+			name:     "max-age minus age",
+			header:   http.Header{"Cache-Control": {"max-age=30"}, "Age": {"10"}},
+			freshFor: time.Second * 20,
+			wantTTL:  time.Hour,
+		},
+		{
+			name: "expires relative to date",
+			header: http.Header{
+				"Date":    {now.UTC().Format(http.TimeFormat)},
+				"Expires": {now.Add(time.Minute * 5).UTC().Format(http.TimeFormat)},
+			},
+			freshFor: time.Minute * 5,
+			wantTTL:  time.Hour,
+		},
+		{
+			name:     "invalid expires as already expired",
+			header:   http.Header{"Expires": {"0"}},
+			freshFor: 0,
+			wantTTL:  time.Hour,
+		},
+		{
+			name:     "no-cache should revalidate",
+			header:   http.Header{"Cache-Control": {"max-age=30, no-cache, stale-while-revalidate=10, stale-if-error=60"}},
+			freshFor: 0,
+			errorFor: time.Minute,
+			wantTTL:  time.Hour,
+		},
+		{
+			name:     "must-revalidate should not serve stale",
+			header:   http.Header{"Cache-Control": {"max-age=30, must-revalidate, stale-if-error=60"}},
+			freshFor: time.Second * 30,
+			wantTTL:  time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPayload(nil)
+			if err := h.applyCacheControl(p, tt.header); err != tt.wantErr {
+				t.Errorf(" = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			near := func(got time.Time, want time.Duration) bool {
+				d := got.Sub(now) - want
+				return d > -time.Second && d < time.Second
+			}
+			if !near(p.BestBefore, tt.freshFor) {
+				t.Errorf("best before = %v, want %v", p.BestBefore.Sub(now), tt.freshFor)
+			}
+			if !near(p.StaleUntil, tt.freshFor+tt.staleFor) {
+				t.Errorf("stale until = %v, want %v", p.StaleUntil.Sub(now), tt.freshFor+tt.staleFor)
+			}
+			if !near(p.StaleIfError, tt.freshFor+tt.errorFor) {
+				t.Errorf("stale if error = %v, want %v", p.StaleIfError.Sub(now), tt.freshFor+tt.errorFor)
+			}
+			if p.ttl != tt.wantTTL {
+				t.Errorf("ttl = %v, want %v", p.ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestHTTP_HonorCacheControl(t *testing.T) {
+	var (
+		counter      = 0
+		cacheControl = ""
+		fail         = false
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheControl)
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.HonorCacheControl = true
+	h.AcceptResponse = func(res *http.Response) bool {
+		if res.StatusCode >= 500 {
+			return false
+		}
+		return true
+	}
+	cached := h.Handler(handler)
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+
+	cacheControl = "no-store"
+	if get("/a") != "1" || get("/a") != "2" {
+		t.Error("no-store should not be cached")
+	}
+
+	cacheControl = "max-age=60"
+	if get("/b") != "3" || get("/b") != "3" {
+		t.Error("max-age should be cached")
+	}
+
+	cacheControl = "no-cache, stale-if-error=60"
+	if get("/c") != "4" || get("/c") != "5" {
+		t.Error("no-cache should revalidate before serving")
+	}
+	fail = true
+	if body := get("/c"); body != "5" {
+		t.Errorf(" = %v, want %v, should serve stale if error", body, "5")
+	}
+	fail = false
+
+	cacheControl = "max-age=0, stale-while-revalidate=60"
+	if get("/d") != "7" || get("/d") != "7" {
+		t.Error("should serve stale while revalidate")
+	}
+	if body := get("/d"); body != "8" {
+		t.Errorf(" = %v, want %v, should be revalidated in background", body, "8")
+	}
+}
+
+func TestHTTP_AcceptRequestCacheControl(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.AcceptRequestCacheControl = func(r *http.Request) bool {
+		return r.Header.Get("X-Trusted") != ""
+	}
+	cached := h.Handler(handler)
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", url, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		if _, ok := header["X-Trusted"]; !ok {
+			r.Header.Set("X-Trusted", "1")
+		}
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+	tests := []struct {
+		name     string
+		url      string
+		header   http.Header
+		wantCode int
+		wantBody string
+	}{
+		{"only-if-cached miss", "/a", http.Header{"Cache-Control": {"only-if-cached"}}, http.StatusGatewayTimeout, ""},
+		{"miss", "/a", nil, http.StatusOK, "1"},
+		{"hit", "/a", nil, http.StatusOK, "1"},
+		{"only-if-cached hit", "/a", http.Header{"Cache-Control": {"only-if-cached"}}, http.StatusOK, "1"},
+		{"no-cache", "/a", http.Header{"Cache-Control": {"no-cache"}}, http.StatusOK, "2"},
+		{"revalidated", "/a", nil, http.StatusOK, "2"},
+		{"pragma no-cache", "/a", http.Header{"Pragma": {"no-cache"}}, http.StatusOK, "3"},
+		{"max-age exceeded", "/a", http.Header{"Cache-Control": {"max-age=0"}}, http.StatusOK, "4"},
+		{"max-age within", "/a", http.Header{"Cache-Control": {"max-age=60"}}, http.StatusOK, "4"},
+		{"min-fresh exceeded", "/a", http.Header{"Cache-Control": {"min-fresh=120"}}, http.StatusOK, "5"},
+		{"min-fresh within", "/a", http.Header{"Cache-Control": {"min-fresh=30"}}, http.StatusOK, "5"},
+		{"untrusted", "/a", http.Header{"Cache-Control": {"no-cache"}, "X-Trusted": {""}}, http.StatusOK, "5"},
+		{"only-if-cached max-age exceeded", "/a", http.Header{"Cache-Control": {"only-if-cached, max-age=0"}}, http.StatusGatewayTimeout, ""},
+		{"only-if-cached min-fresh exceeded", "/a", http.Header{"Cache-Control": {"only-if-cached, min-fresh=120"}}, http.StatusGatewayTimeout, ""},
+		{"only-if-cached within", "/a", http.Header{"Cache-Control": {"only-if-cached, max-age=60"}}, http.StatusOK, "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.url, tt.header)
+			if w.Code != tt.wantCode || w.Body.String() != tt.wantBody {
+				t.Errorf(" = %v %v, want %v %v", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRequestDirectives_MaxStale(t *testing.T) {
+	h := HTTP{AcceptRequestCacheControl: func(*http.Request) bool { return true }}
+	p := newPayload(nil)
+	p.BestBefore = time.Now().Add(-time.Minute)
+	tests := []struct {
+		cacheControl string
+		want         bool
+	}{
+		{"max-stale", true},
+		{"max-stale=120", true},
+		{"max-stale=30", false},
+		{"max-stale=120, min-fresh=0", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Cache-Control", tt.cacheControl)
+		if got := h.requestDirectives(r).acceptable(p); got != tt.want {
+			t.Errorf("%v = %v, want %v", tt.cacheControl, got, tt.want)
+		}
+	}
+}
+
+func TestRequestDirectives_Servable(t *testing.T) {
+	h := HTTP{AcceptRequestCacheControl: func(*http.Request) bool { return true }}
+	p := newPayload(nil)
+	p.BestBefore = time.Now().Add(-time.Minute)
+	p.StaleUntil = time.Now().Add(-time.Second * 30)
+	tests := []struct {
+		cacheControl string
+		want         bool
+	}{
+		{"only-if-cached", false},
+		{"only-if-cached, max-stale", true},
+		{"only-if-cached, max-stale=120", true},
+		{"only-if-cached, max-stale=30", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Cache-Control", tt.cacheControl)
+		if got := h.requestDirectives(r).servable(p); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.cacheControl, got, tt.want)
+		}
+	}
+	p.StaleUntil = time.Time{}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cache-Control", "only-if-cached")
+	if !h.requestDirectives(r).servable(p) {
+		t.Error("should serve stale within stale window")
+	}
+}
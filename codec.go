@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec marshals and unmarshals values of Func client.
+//
+// ID of the codec is stored alongside cached values,
+// so values are always read by the codec that wrote them.
+// ID 0 is reserved for unidentified custom Marshal and Unmarshal functions,
+// 1 to 127 are reserved for built-in codecs
+type Codec interface {
+	// ID unique identifier of the codec
+	ID() byte
+
+	// Marshal returns encoding of v
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal parses encoded data and stores the result in the value pointed to by v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// ProtoMessage interface of protobuf messages with generated Marshal and Unmarshal methods
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+var (
+	// CodecMsgpack msgpack codec, the default codec
+	CodecMsgpack Codec = msgpackCodec{}
+
+	// CodecJSON encoding/json codec
+	CodecJSON Codec = jsonCodec{}
+
+	// CodecGob encoding/gob codec
+	CodecGob Codec = gobCodec{}
+
+	// CodecProto protobuf codec for values implementing ProtoMessage
+	CodecProto Codec = protoCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{}
+)
+
+func init() {
+	for _, c := range []Codec{CodecMsgpack, CodecJSON, CodecGob, CodecProto} {
+		codecs[c.ID()] = c
+	}
+}
+
+// RegisterCodec registers custom codec by its ID from 128 to 255,
+// returns error if ID is reserved or already registered
+func RegisterCodec(c Codec) error {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	id := c.ID()
+	if id < 128 {
+		return fmt.Errorf("hybridcache: codec id %d is reserved", id)
+	}
+	if _, ok := codecs[id]; ok {
+		return fmt.Errorf("hybridcache: codec id %d already registered", id)
+	}
+	codecs[id] = c
+	return nil
+}
+
+// unregisterCodec removes codec of id from registry
+func unregisterCodec(id byte) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	delete(codecs, id)
+}
+
+// LookupCodec returns registered codec by ID
+func LookupCodec(id byte) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[id]
+	return c, ok
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte {
+	return 1
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte {
+	return 2
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) ID() byte {
+	return 3
+}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ID() byte {
+	return 4
+}
+
+func (protoCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return nil, fmt.Errorf("hybridcache: %T does not implement ProtoMessage", v)
+	}
+	return m.Marshal()
+}
+
+func (protoCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return fmt.Errorf("hybridcache: %T does not implement ProtoMessage", v)
+	}
+	return m.Unmarshal(data)
+}
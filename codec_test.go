@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testProto struct {
+	Name string
+}
+
+func (m *testProto) Marshal() ([]byte, error) {
+	return []byte(m.Name), nil
+}
+
+func (m *testProto) Unmarshal(b []byte) error {
+	m.Name = string(b)
+	return nil
+}
+
+type testCodec struct{}
+
+func (testCodec) ID() byte {
+	return 200
+}
+
+func (testCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(*v.(*string)), nil
+}
+
+func (testCodec) Unmarshal(b []byte, v interface{}) error {
+	*v.(*string) = string(b)
+	return nil
+}
+
+func TestCodec(t *testing.T) {
+	for _, c := range []Codec{CodecMsgpack, CodecJSON, CodecGob} {
+		b, err := c.Marshal(map[string]int{"a": 1})
+		if err != nil {
+			t.Error(err)
+		}
+		var v map[string]int
+		if err := c.Unmarshal(b, &v); err != nil || v["a"] != 1 {
+			t.Error(v, err, "should marshal and unmarshal", c.ID())
+		}
+		if res, ok := LookupCodec(c.ID()); !ok || res != c {
+			t.Error("should lookup registered codec", c.ID())
+		}
+	}
+	b, err := CodecProto.Marshal(&testProto{Name: "foo"})
+	if err != nil {
+		t.Error(err)
+	}
+	m := &testProto{}
+	if err := CodecProto.Unmarshal(b, m); err != nil || m.Name != "foo" {
+		t.Error(m, err, "should marshal and unmarshal proto")
+	}
+	if _, err := CodecProto.Marshal("foo"); err == nil {
+		t.Error("should error non proto message")
+	}
+	if err := RegisterCodec(jsonCodec{}); err == nil {
+		t.Error("should error reserved id")
+	}
+	if err := RegisterCodec(testCodec{}); err != nil {
+		t.Error(err)
+	}
+	t.Cleanup(func() {
+		unregisterCodec(testCodec{}.ID())
+	})
+	if err := RegisterCodec(testCodec{}); err == nil {
+		t.Error("should error duplicated id")
+	}
+}
+
+func TestFunc_Codec(t *testing.T) {
+	var (
+		c      = NewMemory(10, int64(10<<20), -1)
+		ctx    = context.Background()
+		fnMsgp = NewFunc(c, time.Second, time.Minute, time.Minute)
+		fnJSON = NewFunc(c, time.Second, time.Minute, time.Minute)
+		val    string
+	)
+	fnJSON.Codec = CodecJSON
+	if err := fnMsgp.Do(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		return "a", nil
+	}, &val); err != nil || val != "a" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if err := fnJSON.Do(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("should read msgpack value without live call")
+	}, &val); err != nil || val != "a" {
+		t.Error(val, err)
+	}
+	if err := fnJSON.Do(ctx, "b", func(ctx context.Context) (interface{}, error) {
+		return "b", nil
+	}, &val); err != nil || val != "b" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	b, _ := c.Get("b")
+	if p, err := parse(b, nil); err != nil || p.Codec != CodecJSON.ID() || string(p.Value) != `"b"` {
+		t.Error(p, err, "should store json with codec id")
+	}
+	if err := fnMsgp.Do(ctx, "b", func(ctx context.Context) (interface{}, error) {
+		return nil, errors.New("should read json value without live call")
+	}, &val); err != nil || val != "b" {
+		t.Error(val, err)
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err, "error closing cache")
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notModifiedHeaders headers sent with 304 Not Modified response
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date", "ETag", "Expires", "Last-Modified", "Vary",
+}
+
+// setValidators generates strong ETag from payload value if not provided by origin.
+// Last-Modified is left to origin, as a generated one would change on every refresh
+func setValidators(p *payload) {
+	if p.StatusCode != http.StatusOK {
+		return
+	}
+	if p.Header == nil {
+		p.Header = http.Header{}
+	}
+	if p.Header.Get("ETag") == "" {
+		sum := sha256.Sum256(p.Value)
+		p.Header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	}
+}
+
+// isNotModified evaluates If-None-Match and If-Modified-Since request headers
+// against the validators of cached response
+func isNotModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, header.Get("ETag"))
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
+
+// etagMatch weak comparison of etag against If-None-Match list
+func etagMatch(list, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" || strings.TrimPrefix(item, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutConditionals returns request without conditional headers
+func withoutConditionals(r *http.Request) *http.Request {
+	if r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "" {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("If-None-Match")
+	r.Header.Del("If-Modified-Since")
+	return r
+}
+
+// writeNotModified writes 304 Not Modified response with the validator headers
+func writeNotModified(w http.ResponseWriter, header http.Header) {
+	for _, k := range notModifiedHeaders {
+		if v := header.Values(k); len(v) > 0 {
+			w.Header()[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// notModifiedIgnoredHeaders headers of 304 Not Modified response
+// that should not update the cached response
+var notModifiedIgnoredHeaders = []string{
+	"Content-Encoding", "Content-Length", "Content-Range",
+}
+
+// revalidateRequest returns request with If-None-Match and If-Modified-Since
+// from validators of the stale payload, or nil if not applicable
+func revalidateRequest(r *http.Request, stale *payload) *http.Request {
+	if stale == nil || stale.StatusCode != http.StatusOK ||
+		r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		return nil
+	}
+	etag, modified := stale.Header.Get("ETag"), stale.Header.Get("Last-Modified")
+	if etag == "" && modified == "" {
+		return nil
+	}
+	r = r.Clone(r.Context())
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if modified != "" {
+		r.Header.Set("If-Modified-Since", modified)
+	}
+	return r
+}
+
+// revalidatedPayload creates payload from the stale payload body
+// with headers updated by 304 Not Modified response
+func (h HTTP) revalidatedPayload(stale *payload, res *http.Response) (p *payload, err error) {
+	p = newPayload(stale.Value)
+	p.StatusCode = stale.StatusCode
+	p.Header = stale.Header.Clone()
+	if p.Header == nil {
+		p.Header = http.Header{}
+	}
+	for k, v := range storedHeader(res.Header) {
+		p.Header[k] = v
+	}
+	for _, k := range notModifiedIgnoredHeaders {
+		if v := stale.Header.Values(k); len(v) > 0 {
+			p.Header[http.CanonicalHeaderKey(k)] = v
+		} else {
+			p.Header.Del(k)
+		}
+	}
+	p.Vary, p.VaryKey = stale.Vary, stale.VaryKey
+	if err = h.applySetCookie(p); err != nil {
+		return
+	}
+	if h.HonorCacheControl {
+		err = h.applyCacheControl(p, p.Header)
+	}
+	return
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Conditional(t *testing.T) {
+	counter := 0
+	modified := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			t.Error("origin should not receive conditional headers")
+		}
+		if r.URL.Path == "/etag" {
+			w.Header().Set("ETag", `"origin"`)
+		}
+		if r.URL.Path == "/modified" {
+			w.Header().Set("Last-Modified", modified)
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.Conditional = true
+	cached := h.Handler(handler)
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", url, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+
+	w := get("/a", http.Header{"If-None-Match": {`"foo"`}})
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "1" || etag == "" || w.Header().Get("Last-Modified") != "" {
+		t.Fatal(w.Code, w.Body.String(), w.Header(), "should generate ETag only")
+	}
+	tests := []struct {
+		name   string
+		url    string
+		header http.Header
+		want   int
+	}{
+		{"matching etag", "/a", http.Header{"If-None-Match": {`"foo", ` + etag}}, http.StatusNotModified},
+		{"weak etag", "/a", http.Header{"If-None-Match": {"W/" + etag}}, http.StatusNotModified},
+		{"any etag", "/a", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"mismatched etag", "/a", http.Header{"If-None-Match": {`"foo"`}}, http.StatusOK},
+		{"no last modified", "/a", http.Header{"If-Modified-Since": {modified}}, http.StatusOK},
+		{"origin last modified", "/modified", http.Header{"If-Modified-Since": {modified}}, http.StatusNotModified},
+		{"etag over modified since", "/modified", http.Header{"If-None-Match": {`"foo"`}, "If-Modified-Since": {modified}}, http.StatusOK},
+		{"modified since", "/modified", http.Header{"If-Modified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusOK},
+		{"origin etag", "/etag", http.Header{"If-None-Match": {`"origin"`}}, http.StatusNotModified},
+		{"origin etag cached", "/etag", http.Header{"If-None-Match": {`"origin"`}}, http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.url, tt.header)
+			if w.Code != tt.want {
+				t.Errorf(" = %v, want %v", w.Code, tt.want)
+			}
+			if w.Code == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("ETag") == "") {
+				t.Error(w.Body.String(), "should write validators without body")
+			}
+		})
+	}
+	if counter != 3 {
+		t.Errorf("counter = %v, want %v", counter, 3)
+	}
+}
+
+func TestHTTP_RoundTrip_Revalidate(t *testing.T) {
+	var (
+		full        = 0
+		notModified = 0
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Revalidated", strconv.Itoa(notModified))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.Header().Set("X-Revalidated", strconv.Itoa(notModified))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("body"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Millisecond*50, time.Hour)
+	cached := roundTripHandler{h.RoundTripper(roundTripper{Handler: handler})}
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, httptest.NewRequest("GET", "http://foo.bar/a", nil))
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+	if w := get(); w.Body.String() != "body" || w.Header().Get("X-Revalidated") != "0" {
+		t.Error(w.Body.String(), w.Header())
+	}
+	time.Sleep(time.Millisecond * 50)
+	if w := get(); w.Body.String() != "body" {
+		t.Error(w.Body.String(), "should serve stale while revalidating")
+	}
+	w := get()
+	if w.Code != http.StatusOK || w.Body.String() != "body" ||
+		w.Header().Get("X-Revalidated") != "1" || w.Header().Get("ETag") != `"v1"` {
+		t.Error(w.Code, w.Body.String(), w.Header(), "should keep body with updated headers")
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("full = %v, not modified = %v, want 1, 1", full, notModified)
+	}
+}
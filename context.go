@@ -11,6 +11,10 @@ type contextKey struct {
 
 var detachedCtxKey = &contextKey{"Detached"}
 
+var staleCtxKey = &contextKey{"Stale"}
+
+var statusCtxKey = &contextKey{"Status"}
+
 type detached struct {
 	ctx context.Context
 }
@@ -42,3 +46,25 @@ func IsDetached(ctx context.Context) bool {
 	_, ok := ctx.Value(detachedCtxKey).(bool)
 	return ok
 }
+
+// withStale returns context carrying the stale payload being refreshed
+func withStale(ctx context.Context, p *payload) context.Context {
+	return context.WithValue(ctx, staleCtxKey, p)
+}
+
+// staleFromContext returns the stale payload being refreshed if any
+func staleFromContext(ctx context.Context) *payload {
+	p, _ := ctx.Value(staleCtxKey).(*payload)
+	return p
+}
+
+// withCacheStatus returns context recording how the response is served into s
+func withCacheStatus(ctx context.Context, s *cacheStatus) context.Context {
+	return context.WithValue(ctx, statusCtxKey, s)
+}
+
+// statusFromContext returns the cache status recorder if any
+func statusFromContext(ctx context.Context) *cacheStatus {
+	s, _ := ctx.Value(statusCtxKey).(*cacheStatus)
+	return s
+}
@@ -3,47 +3,86 @@ package cache
 import (
 	"context"
 	"fmt"
-	"github.com/vmihailenco/msgpack/v5"
 	"time"
 )
 
 func do(
 	ctx context.Context,
-	c Cache, key string,
+	c ContextCache, key string,
 	fn func(context.Context) (*payload, error),
 	waitFor, freshFor, ttl time.Duration,
+	pool *Pool, bg *background,
 ) (p *payload, err error) {
-	if v, e := parse(c.Get(key)); e == nil {
-		p = v
-		if v.NeedRefresh() {
-			ctx = DetachContext(ctx)
-			go func() {
-				if b, _, e := c.Fetch(key); e == nil {
-					if v, e := parse(b, nil); e == nil {
-						if !v.NeedRefresh() {
-							return
-						}
+	if v, e := parse(c.GetContext(ctx, key)); e == nil {
+		return doHit(ctx, c, key, v, fn, waitFor, freshFor, ttl, pool, bg)
+	}
+	statusFromContext(ctx).forward(key, "uri-miss")
+	return doCall(ctx, c, key, fn, waitFor, freshFor, ttl, bg)
+}
+
+// doHit serves the cached payload v, refreshing it if needed
+func doHit(
+	ctx context.Context,
+	c ContextCache, key string, v *payload,
+	fn func(context.Context) (*payload, error),
+	waitFor, freshFor, ttl time.Duration,
+	pool *Pool, bg *background,
+) (p *payload, err error) {
+	p = v
+	s := statusFromContext(ctx)
+	ctx = withStale(ctx, v)
+	if v.NeedRefresh() && !v.CanServeStale() {
+		// stale beyond serving window, refresh before serving
+		s.forward(key, "stale")
+		return doRevalidate(ctx, c, key, v, fn, waitFor, freshFor, ttl, bg)
+	}
+	s.hit(key, v.NeedRefresh(), false)
+	if v.NeedRefresh() {
+		ctx = DetachContext(ctx)
+		refresh := func() {
+			if b, _, e := c.FetchContext(ctx, key); e == nil {
+				if v, e := parse(b, nil); e == nil {
+					if !v.NeedRefresh() {
+						return
 					}
 				}
-				_, _ = doCall(ctx, c, key, fn, waitFor, freshFor, ttl)
-			}()
+			}
+			_, _ = doCall(ctx, c, key, fn, waitFor, freshFor, ttl, bg)
 		}
-		return
+		s.hit(key, true, bg.Submit(pool, key, refresh))
+	}
+	return
+}
+
+// doRevalidate refreshes the cached payload v before serving,
+// falls back to v on error if stale-if-error allows
+func doRevalidate(
+	ctx context.Context,
+	c ContextCache, key string, v *payload,
+	fn func(context.Context) (*payload, error),
+	waitFor, freshFor, ttl time.Duration,
+	bg *background,
+) (p *payload, err error) {
+	p, err = doCall(withStale(ctx, v), c, key, fn, waitFor, freshFor, ttl, bg)
+	if err != nil && v.CanServeStaleIfError() {
+		p, err = v, nil
+		statusFromContext(ctx).hit(key, true, false)
 	}
-	return doCall(ctx, c, key, fn, waitFor, freshFor, ttl)
+	return
 }
 
 func doCall(
 	ctx context.Context,
-	c Cache, key string,
+	c ContextCache, key string,
 	fn func(context.Context) (*payload, error),
 	waitFor, freshFor, ttl time.Duration,
+	bg *background,
 ) (*payload, error) {
 	suppressionTTL := time.Second * 2
 	if suppressionTTL > freshFor {
 		suppressionTTL = freshFor
 	}
-	return parse(c.Race(key, func() ([]byte, error) {
+	return parse(c.RaceContext(ctx, key, func() ([]byte, error) {
 		return callWithTimeout(ctx, func(ctx context.Context) ([]byte, error) {
 			p, err := fn(ctx)
 			if err != nil {
@@ -60,7 +99,12 @@ func doCall(
 			if p == nil {
 				return nil, ErrNotFound
 			}
-			p.FreshFor(freshFor)
+			if p.BestBefore.IsZero() {
+				p.FreshFor(freshFor)
+			}
+			if p.ttl > 0 {
+				ttl = p.ttl
+			}
 			b, err := unparse(p)
 			if err != nil {
 				return nil, err
@@ -69,12 +113,13 @@ func doCall(
 				return nil, err
 			}
 			if IsDetached(ctx) {
-				_ = c.Set(key, b, ttl)
+				_ = c.SetContext(ctx, key, b, ttl)
 			} else {
 				// set in goroutine if not detached
-				go func() {
-					_ = c.Set(key, b, ttl)
-				}()
+				ctx := DetachContext(ctx)
+				bg.Go(func() {
+					_ = c.SetContext(ctx, key, b, ttl)
+				})
 			}
 			return b, nil
 		}, waitFor)
@@ -92,13 +137,14 @@ func parse(val []byte, e error) (p *payload, err error) {
 		return
 	}
 	p = &payload{}
-	if err = msgpack.Unmarshal(val, p); err != nil || !p.IsValid() {
+	if err = unmarshalPayload(val, p); err != nil {
 		if e != nil {
 			err = e
 		} else {
 			err = ErrNotFound
 		}
 		p = nil
+		return
 	}
 	err = e
 	return
@@ -109,7 +155,7 @@ func unparse(p *payload) (b []byte, err error) {
 		err = ErrNotFound
 		return
 	}
-	if b, err = msgpack.Marshal(p); err != nil {
+	if b, err = marshalPayload(p); err != nil {
 		return
 	}
 	return
@@ -153,6 +199,7 @@ var errMap = (func() map[string]error {
 	for _, err := range []error{
 		ErrNoCache,
 		ErrNotFound,
+		errBypass,
 		context.Canceled,
 		context.DeadlineExceeded,
 	} {
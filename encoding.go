@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Encoding content coding of cached response bodies
+type Encoding interface {
+	// Name content coding token of Content-Encoding and Accept-Encoding headers
+	Name() string
+
+	// Encode compresses body
+	Encode([]byte) ([]byte, error)
+
+	// Decode decompresses body
+	Decode([]byte) ([]byte, error)
+}
+
+// EncodingGzip gzip content coding
+var EncodingGzip Encoding = gzipEncoding{}
+
+// minEncodeSize minimum body size worth compressing
+const minEncodeSize = 256
+
+// incompressibleTypes content type prefixes of already compressed formats
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/octet-stream",
+}
+
+type gzipEncoding struct{}
+
+func (gzipEncoding) Name() string {
+	return "gzip"
+}
+
+func (gzipEncoding) Encode(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipEncoding) Decode(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// encoding returns Encoding of content coding name
+func (h HTTP) encoding(name string) Encoding {
+	if h.Encoding != nil && strings.EqualFold(h.Encoding.Name(), name) {
+		return h.Encoding
+	}
+	if strings.EqualFold(name, EncodingGzip.Name()) {
+		return EncodingGzip
+	}
+	return nil
+}
+
+// fillRequest returns request asking origin for either the identity
+// or the configured encoding accepted by the client
+func (h HTTP) fillRequest(r *http.Request) *http.Request {
+	if h.Encoding == nil {
+		return r
+	}
+	r = r.Clone(r.Context())
+	if acceptsEncoding(r, h.Encoding.Name()) {
+		r.Header.Set("Accept-Encoding", h.Encoding.Name())
+	} else {
+		r.Header.Set("Accept-Encoding", "identity")
+	}
+	return r
+}
+
+// encode compresses payload body with the configured Encoding
+func (h HTTP) encode(p *payload) {
+	if h.Encoding == nil || p.Header.Get("Content-Encoding") != "" || len(p.Value) < minEncodeSize {
+		return
+	}
+	contentType := p.Header.Get("Content-Type")
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return
+		}
+	}
+	b, err := h.Encoding.Encode(p.Value)
+	if err != nil {
+		return
+	}
+	p.Value = b
+	p.Header.Set("Content-Encoding", h.Encoding.Name())
+	p.Header.Del("Content-Length")
+	weakenETag(p.Header)
+	if !hasToken(p.Header.Values("Vary"), "Accept-Encoding") {
+		p.Header.Add("Vary", "Accept-Encoding")
+	}
+}
+
+// negotiate returns payload for the client,
+// decoded if client does not accept the stored content coding
+func (h HTTP) negotiate(r *http.Request, p *payload) *payload {
+	name := p.Header.Get("Content-Encoding")
+	if name == "" || acceptsEncoding(r, name) {
+		return p
+	}
+	enc := h.encoding(name)
+	if enc == nil {
+		return p
+	}
+	b, err := enc.Decode(p.Value)
+	if err != nil {
+		return p
+	}
+	decoded := *p
+	decoded.Value = b
+	decoded.Header = p.Header.Clone()
+	decoded.Header.Del("Content-Encoding")
+	decoded.Header.Del("Content-Length")
+	weakenETag(decoded.Header)
+	return &decoded
+}
+
+// acceptsEncoding returns if Accept-Encoding of request allows content coding name
+func acceptsEncoding(r *http.Request, name string) bool {
+	if strings.EqualFold(name, "identity") {
+		return true
+	}
+	accept := false
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			coding, q := item, 1.0
+			if i := strings.IndexByte(item, ';'); i >= 0 {
+				coding = item[:i]
+				param := strings.TrimSpace(item[i+1:])
+				if strings.HasPrefix(param, "q=") {
+					q, _ = strconv.ParseFloat(param[2:], 64)
+				}
+			}
+			coding = strings.TrimSpace(coding)
+			if strings.EqualFold(coding, name) {
+				return q > 0
+			}
+			if coding == "*" {
+				accept = q > 0
+			}
+		}
+	}
+	return accept
+}
+
+// weakenETag marks strong ETag weak, for representation other than the origin one
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// hasToken returns if comma separated header values contains token
+func hasToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
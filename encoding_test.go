@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		name   string
+		want   bool
+	}{
+		{"", "gzip", false},
+		{"", "identity", true},
+		{"gzip, deflate, br", "gzip", true},
+		{"GZIP;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"br, *", "gzip", true},
+		{"*;q=0, br", "gzip", false},
+		{"*, gzip;q=0", "gzip", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		if got := acceptsEncoding(r, tt.name); got != tt.want {
+			t.Errorf("%v %v = %v, want %v", tt.accept, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHTTP_Encoding(t *testing.T) {
+	var (
+		counter = 0
+		body    = strings.Repeat("hello world ", 100)
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		if r.Header.Get("Accept-Encoding") != "identity" {
+			t.Errorf("Accept-Encoding = %v, origin should be asked for identity", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(body))
+	})
+	c := NewMemory(10, int64(10<<20), -1)
+	h := NewHTTP(c, time.Second, time.Minute, time.Hour)
+	h.Encoding = EncodingGzip
+	cached := h.Handler(handler)
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/a", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+	if w := get("identity"); w.Body.String() != body {
+		t.Error("should stream identity body to client")
+	}
+	b, _ := c.Get("/a")
+	p, err := parse(b, nil)
+	if err != nil || p.Header.Get("Content-Encoding") != "gzip" || len(p.Value) >= len(body) {
+		t.Fatal(p, err, "should store compressed body")
+	}
+	w := get("gzip, deflate")
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") != `W/"v1"` ||
+		w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Error(w.Header(), "should serve compressed body")
+	}
+	if decoded, err := EncodingGzip.Decode(w.Body.Bytes()); err != nil || string(decoded) != body {
+		t.Error(err, "should serve gzip body")
+	}
+	w = get("br")
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Error(w.Header(), "should decode body for client not accepting gzip")
+	}
+	if counter != 1 {
+		t.Errorf("counter = %v, Vary Accept-Encoding should not split cache", counter)
+	}
+}
@@ -2,7 +2,6 @@ package cache
 
 import (
 	"context"
-	"github.com/vmihailenco/msgpack/v5"
 	"time"
 )
 
@@ -20,11 +19,27 @@ type Func struct {
 	// TTL duration for cache to stay
 	TTL time.Duration
 
-	// custom Marshal function, default msgpack
+	// KeyFunc optional function transforms keys before reaching the cache adaptor,
+	// such as SafeKey for long keys
+	KeyFunc KeyFunc
+
+	// Pool optional worker pool for background refreshes,
+	// by default each refresh runs in its own goroutine
+	Pool *Pool
+
+	// Codec marshals and unmarshals values, default CodecMsgpack.
+	// Its ID is stored alongside cached values,
+	// so values are always read by the codec that wrote them
+	Codec Codec
+
+	// custom Marshal function, takes precedence over Codec
 	Marshal func(interface{}) ([]byte, error)
 
-	// custom Unmarshal function, default msgpack
+	// custom Unmarshal function, takes precedence over Codec
+	// for values not written by a registered codec
 	Unmarshal func([]byte, interface{}) error
+
+	bg *background
 }
 
 // NewFunc creates cache function client with options:
@@ -37,6 +52,7 @@ func NewFunc(c Cache, waitFor, freshFor, ttl time.Duration) *Func {
 		WaitFor:  waitFor,
 		FreshFor: freshFor,
 		TTL:      ttl,
+		bg:       &background{},
 	}
 }
 
@@ -49,28 +65,25 @@ func (f Func) Do(
 	fn func(context.Context) (interface{}, error),
 	v interface{},
 ) (err error) {
-	var pfn = func(ctx context.Context) (*payload, error) {
-		v, err := fn(ctx)
-		b, e := f.marshal(v)
-		if e != nil {
-			return nil, e
-		}
-		return newPayload(b), err
-	}
-	var p *payload
-	if p, err = do(ctx, f.Cache, key, pfn, f.WaitFor, f.FreshFor, f.TTL); p == nil {
+	var (
+		c   = WithContext(f.Cache)
+		pfn = f.payloadFunc(fn)
+		p   *payload
+	)
+	key = f.key(key)
+	if p, err = do(ctx, c, key, pfn, f.WaitFor, f.FreshFor, f.TTL, f.Pool, f.background()); p == nil {
 		return
 	}
-	if e := f.unmarshal(p.Value, v); e != nil {
+	if e := f.unmarshal(p, v); e != nil {
 		// if already err then leave it
 		if err != nil {
 			return
 		}
 		// cache payload valid but value corrupted, get live and try once more
-		if p, err = doCall(ctx, f.Cache, key, pfn, f.WaitFor, f.FreshFor, f.TTL); err != nil {
+		if p, err = doCall(ctx, c, key, pfn, f.WaitFor, f.FreshFor, f.TTL, f.background()); err != nil {
 			return
 		}
-		if err = f.unmarshal(p.Value, v); err != nil {
+		if err = f.unmarshal(p, v); err != nil {
 			return
 		}
 	}
@@ -86,26 +99,94 @@ func (f Func) DoBytes(
 	fn func(context.Context) ([]byte, error),
 ) (value []byte, err error) {
 	var p *payload
-	if p, err = do(ctx, f.Cache, key, func(ctx context.Context) (*payload, error) {
+	if p, err = do(ctx, WithContext(f.Cache), f.key(key), func(ctx context.Context) (*payload, error) {
 		b, err := fn(ctx)
 		return newPayload(b), err
-	}, f.WaitFor, f.FreshFor, f.TTL); p == nil {
+	}, f.WaitFor, f.FreshFor, f.TTL, f.Pool, f.background()); p == nil {
 		return
 	}
 	value = p.Value
 	return
 }
 
-func (f Func) marshal(v interface{}) (b []byte, err error) {
+// Shutdown stops new background work, waits for in-flight refreshes
+// and writes until context done, and then closes the cache.
+// The cache is not closed if work is still in flight at context done.
+// Func not created by NewFunc is tracked by its cache adapter,
+// returns ErrNotSupported if the adapter is not comparable
+func (f Func) Shutdown(ctx context.Context) error {
+	bg := f.background()
+	if bg == nil {
+		return ErrNotSupported
+	}
+	if err := bg.Shutdown(ctx); err != nil {
+		// cache is left open for the work still in flight
+		return err
+	}
+	return shutdown(ctx, f.Cache)
+}
+
+// background returns background of Func, or of its cache adapter if not created by NewFunc
+func (f Func) background() *background {
+	if f.bg != nil {
+		return f.bg
+	}
+	return cacheBackground(f.Cache)
+}
+
+func (f Func) key(key string) string {
+	if f.KeyFunc != nil {
+		return f.KeyFunc(key)
+	}
+	return key
+}
+
+func (f Func) payloadFunc(
+	fn func(context.Context) (interface{}, error),
+) func(context.Context) (*payload, error) {
+	return func(ctx context.Context) (*payload, error) {
+		v, err := fn(ctx)
+		p, e := f.marshal(v)
+		if e != nil {
+			return nil, e
+		}
+		return p, err
+	}
+}
+
+func (f Func) marshal(v interface{}) (*payload, error) {
 	if f.Marshal != nil {
-		return f.Marshal(v)
+		b, err := f.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return newPayload(b), nil
+	}
+	c := f.codec()
+	b, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
 	}
-	return msgpack.Marshal(v)
+	p := newPayload(b)
+	p.Codec = c.ID()
+	return p, nil
 }
 
-func (f Func) unmarshal(b []byte, v interface{}) (err error) {
+// unmarshal value of payload by the codec that wrote it if registered,
+// otherwise by the custom Unmarshal function or Codec
+func (f Func) unmarshal(p *payload, v interface{}) error {
+	if c, ok := LookupCodec(p.Codec); ok {
+		return c.Unmarshal(p.Value, v)
+	}
 	if f.Unmarshal != nil {
-		return f.Unmarshal(b, v)
+		return f.Unmarshal(p.Value, v)
+	}
+	return f.codec().Unmarshal(p.Value, v)
+}
+
+func (f Func) codec() Codec {
+	if f.Codec != nil {
+		return f.Codec
 	}
-	return msgpack.Unmarshal(b, v)
+	return CodecMsgpack
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/vmihailenco/msgpack/v5"
 	"golang.org/x/sync/errgroup"
 	"reflect"
 	"strconv"
@@ -227,9 +228,12 @@ func DoTestFuncDo(name string, t *testing.T, c Cache) {
 		var (
 			fn     = NewFunc(c, time.Millisecond*50, time.Millisecond*50, time.Second*2)
 			fnJSON = NewFunc(c, time.Millisecond*50, time.Millisecond*50, time.Second*2)
+			fnMsgp = NewFunc(c, time.Millisecond*50, time.Millisecond*50, time.Second*2)
 		)
 		fnJSON.Marshal = json.Marshal
 		fnJSON.Unmarshal = json.Unmarshal
+		fnMsgp.Marshal = msgpack.Marshal
+		fnMsgp.Unmarshal = msgpack.Unmarshal
 		tests := []struct {
 			name         string
 			key          string
@@ -286,12 +290,34 @@ func DoTestFuncDo(name string, t *testing.T, c Cache) {
 				sleep:   time.Millisecond * 101,
 			},
 			{
-				name: "cached value corrupted should be treated as cache miss",
+				name: "cached value should be read by the codec that wrote it",
 				key:  "a",
 				c:    fnJSON,
 				fn: func(ctx context.Context) (interface{}, error) {
 					return "asdf", nil
 				},
+				wantVal: "d",
+				noErr:   true,
+				sleep:   time.Millisecond,
+			},
+			{
+				name: "custom marshal should not store codec",
+				key:  "e",
+				c:    fnMsgp,
+				fn: func(ctx context.Context) (interface{}, error) {
+					return "e", nil
+				},
+				wantVal: "e",
+				noErr:   true,
+				sleep:   time.Millisecond * 10,
+			},
+			{
+				name: "cached value corrupted should be treated as cache miss",
+				key:  "e",
+				c:    fnJSON,
+				fn: func(ctx context.Context) (interface{}, error) {
+					return "asdf", nil
+				},
 				wantVal: "asdf",
 				noErr:   true,
 				sleep:   time.Millisecond,
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"net/http"
+)
+
+// headDirectives returns request directives of HEAD request,
+// that is only served from cache unless HeadFill
+func (h HTTP) headDirectives(r *http.Request, d *requestDirectives) *requestDirectives {
+	if r.Method != http.MethodHead || h.HeadFill {
+		return d
+	}
+	head := requestDirectives{maxAge: -1, maxStale: -1, minFresh: -1}
+	if d != nil {
+		head = *d
+	}
+	head.onlyIfCached = true
+	return &head
+}
+
+// isHeadMiss returns if error is a HEAD request not found in cache
+// that should be passed through to origin
+func isHeadMiss(r *http.Request, d *requestDirectives, err error) bool {
+	return err == errOnlyIfCached && r.Method == http.MethodHead && (d == nil || !d.onlyIfCached)
+}
+
+// asGet returns GET request of HEAD request, fetching the full response for cache
+func asGet(r *http.Request) *http.Request {
+	if r.Method != http.MethodHead {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Method = http.MethodGet
+	return r
+}
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Head(t *testing.T) {
+	var methods []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("X-Foo", "bar")
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte("hello"))
+		}
+	})
+	for _, fill := range []bool{false, true} {
+		h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+		h.HeadFill = fill
+		c := *h
+		c.Cache = NewMemory(10, int64(10<<20), -1)
+		handlers := map[string]http.Handler{
+			"Handler":      h.Handler(handler),
+			"RoundTripper": roundTripHandler{c.RoundTripper(roundTripper{Handler: handler})},
+		}
+		for name, cached := range handlers {
+			methods = nil
+			t.Run(name, func(t *testing.T) {
+				do := func(method string) *httptest.ResponseRecorder {
+					w := httptest.NewRecorder()
+					cached.ServeHTTP(w, httptest.NewRequest(method, "http://foo.bar/a", nil))
+					time.Sleep(time.Millisecond * 10)
+					return w
+				}
+				do(http.MethodHead)
+				if fill {
+					if len(methods) != 1 || methods[0] != http.MethodGet {
+						t.Errorf("methods = %v, HEAD miss should fill through GET", methods)
+					}
+				} else {
+					if len(methods) != 1 || methods[0] != http.MethodHead {
+						t.Errorf("methods = %v, HEAD miss should pass through", methods)
+					}
+					if w := do(http.MethodGet); w.Body.String() != "hello" {
+						t.Errorf(" = %v, want %v", w.Body.String(), "hello")
+					}
+				}
+				methods = nil
+				w := do(http.MethodHead)
+				if w.Code != http.StatusOK || w.Body.Len() != 0 ||
+					w.Header().Get("Content-Length") != "5" || w.Header().Get("X-Foo") != "bar" {
+					t.Error(w.Code, w.Body.String(), w.Header(), "should serve HEAD from cached GET")
+				}
+				if w := do(http.MethodGet); w.Body.String() != "hello" {
+					t.Errorf(" = %v, want %v", w.Body.String(), "hello")
+				}
+				if len(methods) != 0 {
+					t.Errorf("methods = %v, should be served from cache", methods)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// SetCookiePolicy decides how HTTP handles responses with Set-Cookie header
+type SetCookiePolicy int
+
+const (
+	// SetCookieNoCache does not cache responses with Set-Cookie
+	SetCookieNoCache SetCookiePolicy = iota
+
+	// SetCookieStrip caches responses without Set-Cookie,
+	// the cookies are only sent to the request that fetched the response
+	SetCookieStrip
+
+	// SetCookieCache caches responses with Set-Cookie,
+	// the cookies are sent to every request served from cache
+	SetCookieCache
+)
+
+// hopByHopHeaders headers meaningful only for a single transport-level connection
+var hopByHopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "TE", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// storedHeader returns copy of response header without hop-by-hop headers
+func storedHeader(header http.Header) http.Header {
+	h := header.Clone()
+	if h == nil {
+		return http.Header{}
+	}
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+	return h
+}
+
+// copyHeader copies all values of header src into dst
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+// applySetCookie applies SetCookie policy to payload,
+// returns ErrNoCache if response should not be cached
+func (h HTTP) applySetCookie(p *payload) error {
+	if _, ok := p.Header["Set-Cookie"]; !ok {
+		return nil
+	}
+	switch h.SetCookie {
+	case SetCookieStrip:
+		p.Header.Del("Set-Cookie")
+	case SetCookieCache:
+	default:
+		return ErrNoCache
+	}
+	return nil
+}
+
+// restoreSetCookie adds back Set-Cookie stripped from cached or uncached response,
+// only if the response was fetched by the current request
+func (h HTTP) restoreSetCookie(header http.Header, setCookie *atomic.Value) {
+	if _, ok := header["Set-Cookie"]; ok {
+		return
+	}
+	if v, _ := setCookie.Load().([]string); len(v) > 0 {
+		header["Set-Cookie"] = v
+	}
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Header(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		w.Header().Add("Set-Cookie", "a=1; Path=/")
+		w.Header().Add("Set-Cookie", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("Connection", "keep-alive, X-Hop")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Hop", "1")
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	})
+	cookies := []string{"a=1; Path=/", "b=2; Expires=Wed, 21 Oct 2015 07:28:00 GMT"}
+	tests := []struct {
+		name       string
+		policy     SetCookiePolicy
+		wantBody   []string
+		wantCookie [][]string
+	}{
+		{"no cache", SetCookieNoCache, []string{"1", "2"}, [][]string{cookies, cookies}},
+		{"strip", SetCookieStrip, []string{"1", "1"}, [][]string{cookies, nil}},
+		{"cache", SetCookieCache, []string{"1", "1"}, [][]string{cookies, cookies}},
+	}
+	for _, tt := range tests {
+		h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+		h.SetCookie = tt.policy
+		c := *h
+		c.Cache = NewMemory(10, int64(10<<20), -1)
+		handlers := map[string]http.Handler{
+			"Handler":      h.Handler(handler),
+			"RoundTripper": roundTripHandler{c.RoundTripper(roundTripper{Handler: handler})},
+		}
+		for name, cached := range handlers {
+			counter = 0
+			t.Run(tt.name+" "+name, func(t *testing.T) {
+				for i := range tt.wantBody {
+					w := httptest.NewRecorder()
+					cached.ServeHTTP(w, httptest.NewRequest("GET", "/a", nil))
+					time.Sleep(time.Millisecond * 10)
+					if w.Body.String() != tt.wantBody[i] {
+						t.Errorf("body = %v, want %v", w.Body.String(), tt.wantBody[i])
+					}
+					if got := w.Header()["Set-Cookie"]; !reflect.DeepEqual(got, tt.wantCookie[i]) {
+						t.Errorf("Set-Cookie = %q, want %q", got, tt.wantCookie[i])
+					}
+					if got := w.Header()["X-Multi"]; !reflect.DeepEqual(got, []string{"a", "b"}) {
+						t.Errorf("X-Multi = %q, should replay values", got)
+					}
+					for _, k := range []string{"Connection", "Keep-Alive", "X-Hop"} {
+						if v := w.Header().Get(k); v != "" {
+							t.Errorf("%v = %v, should strip hop-by-hop header", k, v)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestHTTP_SetCookie_Race(t *testing.T) {
+	var fetched int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		time.Sleep(time.Millisecond * 50)
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte("ok"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	c := *h
+	c.Cache = NewMemory(10, int64(10<<20), -1)
+	handlers := map[string]http.Handler{
+		"Handler":      h.Handler(handler),
+		"RoundTripper": roundTripHandler{c.RoundTripper(roundTripper{Handler: handler})},
+	}
+	for name, cached := range handlers {
+		atomic.StoreInt32(&fetched, 0)
+		t.Run(name, func(t *testing.T) {
+			var (
+				wg      sync.WaitGroup
+				cookies int32
+			)
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w := httptest.NewRecorder()
+					cached.ServeHTTP(w, httptest.NewRequest("GET", "/a", nil))
+					if w.Header().Get("Set-Cookie") != "" {
+						atomic.AddInt32(&cookies, 1)
+					}
+				}()
+			}
+			wg.Wait()
+			if n := atomic.LoadInt32(&fetched); n >= 5 {
+				t.Fatalf("fetched = %v, requests should be merged", n)
+			}
+			if got, want := atomic.LoadInt32(&cookies), atomic.LoadInt32(&fetched); got != want {
+				t.Errorf("cookies = %v, want %v, only fetching requests should receive Set-Cookie", got, want)
+			}
+		})
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/httptest"
-	"strings"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -25,28 +25,127 @@ type HTTP struct {
 	// TTL duration for cache to stay
 	TTL time.Duration
 
+	// Pool optional worker pool for background refreshes,
+	// by default each refresh runs in its own goroutine
+	Pool *Pool
+
 	// RequestKey function generates string key from incoming request
 	//
 	// by default request URL is used as key
 	RequestKey func(*http.Request) string
 
+	// KeyFunc optional function transforms keys generated by RequestKey,
+	// such as SafeKey for long URLs
+	KeyFunc KeyFunc
+
 	// AcceptRequest optional function determine request should be handled
 	//
-	// by default only GET requests are handled
+	// by default only GET and HEAD requests are handled
 	AcceptRequest func(*http.Request) bool
 
+	// HeadFill enables HEAD requests not found in cache to fill the cache
+	// through a GET request to origin.
+	//
+	// by default HEAD requests are answered from cached GET responses if found,
+	// otherwise passed through to origin
+	HeadFill bool
+
 	// AcceptResponse function determine response should be cached
 	//
 	// by default only status code < 400 response are cached
 	AcceptResponse func(*http.Response) bool
 
+	// IgnoreVary disables Vary header handling.
+	//
+	// by default the first response of a key records the request headers it varies on,
+	// and later requests with different header values are cached under variant keys
+	IgnoreVary bool
+
+	// HonorCacheControl enables RFC 9111 aware caching,
+	// where freshness derives from origin Cache-Control max-age, s-maxage or Expires,
+	// stale-while-revalidate and stale-if-error bound how long stale content is served,
+	// no-store and private responses are not cached,
+	// and no-cache responses are revalidated before serving
+	HonorCacheControl bool
+
+	// Conditional enables conditional requests for Handler,
+	// where strong ETag is generated for cached responses
+	// if not provided by origin, and requests with matching If-None-Match or
+	// If-Modified-Since are answered with 304 Not Modified from cache
+	Conditional bool
+
+	// AcceptRequestCacheControl optional function determine client request directives
+	// should be respected, such as for trusted callers.
+	//
+	// by default request directives are ignored. When accepted,
+	// Cache-Control no-cache or Pragma no-cache forces revalidation,
+	// max-age, max-stale and min-fresh revalidate cached responses outside their bounds,
+	// and only-if-cached results 504 Gateway Timeout if not cached
+	AcceptRequestCacheControl func(*http.Request) bool
+
+	// Encoding optional content coding of cached response bodies for Handler,
+	// such as EncodingGzip. Responses are stored once compressed,
+	// served as is to clients accepting the encoding and decoded for the others,
+	// and Vary on Accept-Encoding does not split the cache
+	Encoding Encoding
+
+	// MaxBodySize maximum size of response body to be cached,
+	// larger responses stream through to client without caching.
+	//
+	// by default there is no limit
+	MaxBodySize int64
+
+	// SetCookie policy of responses with Set-Cookie header,
+	// default SetCookieNoCache
+	SetCookie SetCookiePolicy
+
+	// StatusHeaders enables cache status response headers:
+	// Age from the stored time of response, X-Cache of HIT, STALE or MISS,
+	// and RFC 9211 Cache-Status with key, remaining freshness
+	// and whether a background refresh was triggered
+	StatusHeaders bool
+
+	// CacheName identifies the cache in Cache-Status header,
+	// defaults to hybridcache
+	CacheName string
+
+	// AcceptPost optional function determine POST request should be cached,
+	// such as idempotent GraphQL or search queries. Accepted requests are keyed
+	// by method, URL and a hash of the request body, where JSON and form bodies
+	// are normalized, and the body is restored for the next handler
+	AcceptPost func(*http.Request) bool
+
+	// MaxRequestBody maximum size of POST request body to be hashed,
+	// larger requests pass through without caching.
+	//
+	// by default 1 MiB
+	MaxRequestBody int64
+
+	// ShareCredentials caches requests with Authorization or Cookie header as shared responses.
+	//
+	// by default such requests are not cached unless handled by Private
+	ShareCredentials bool
+
+	// Private optional per-user caching of requests with Authorization or Cookie header,
+	// where Cache-Control private responses are also cached
+	Private *Private
+
+	// ServeStaleOnError enables Handler to serve the stale response still in cache
+	// when fetching fails, with Warning header and stale detail of Cache-Status
+	ServeStaleOnError bool
+
 	// ErrorHandler function handles errors
 	//
-	// by default context deadline will result 408 error, 400 error for anything else
+	// by default context deadline will result 504 error, 502 error for anything else
 	ErrorHandler func(http.ResponseWriter, *http.Request, error)
 
 	// Transport the http.RoundTripper to wrap. Defaults to http.DefaultTransport
 	Transport http.RoundTripper
+
+	bg *background
+
+	// private whether entries are of Private user
+	private bool
 }
 
 // NewHTTP creates cache HTTP middleware client with options:
@@ -59,13 +158,14 @@ func NewHTTP(c Cache, waitFor, freshFor, ttl time.Duration) *HTTP {
 		WaitFor:  waitFor,
 		FreshFor: freshFor,
 		TTL:      ttl,
+		bg:       &background{},
 		RequestKey: func(r *http.Request) string {
 			// default using url as key
 			return r.URL.String()
 		},
 		AcceptRequest: func(r *http.Request) bool {
-			// default only GET requests will be handled
-			return r.Method == http.MethodGet
+			// default only GET and HEAD requests will be handled
+			return r.Method == http.MethodGet || r.Method == http.MethodHead
 		},
 		AcceptResponse: func(res *http.Response) bool {
 			// default status code < 400 will be cached
@@ -78,102 +178,215 @@ func NewHTTP(c Cache, waitFor, freshFor, ttl time.Duration) *HTTP {
 func (h HTTP) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
-			key = r.URL.String()
-			ctx = r.Context()
-			p   *payload
-			err error
+			ctx    = r.Context()
+			p      *payload
+			err    error
+			status *cacheStatus
+			// origin Set-Cookie if response fetched by this request
+			setCookie atomic.Value
 		)
-		if h.AcceptRequest != nil && !h.AcceptRequest(r) {
+		// h of the request, with private options applied if any
+		h, r, key, reqBody, ok := h.cacheRequest(r)
+		if !ok || isStreamingRequest(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
-		if h.RequestKey != nil {
-			key = h.RequestKey(r)
+		live := newLiveWriter(w)
+		// whether next handler has been run for this request
+		var fetched int32
+		if h.StatusHeaders {
+			status = &cacheStatus{}
+			ctx = withCacheStatus(ctx, status)
+			live.onHeader = func(header http.Header, code int) {
+				h.setStatusHeaders(header, h.headerPayload(header, code), status)
+			}
 		}
-		if p, err = do(ctx, h.Cache, key, func(ctx context.Context) (p *payload, err error) {
+		// stream to client unless response is needed to evaluate client validators or ranges
+		streamable := (!h.Conditional ||
+			r.Header.Get("If-None-Match") == "" && r.Header.Get("If-Modified-Since") == "") &&
+			r.Header.Get("Range") == "" && r.Method != http.MethodHead
+		// context of the client request, outliving the fetch once streamed to client
+		client := ctx
+		d := h.requestDirectives(r)
+		p, err = h.do(ctx, r, key, h.headDirectives(r, d), func(ctx context.Context) (p *payload, err error) {
 			var (
-				ww  = httptest.NewRecorder()
-				rr  = r.WithContext(ctx)
+				tw  = newTeeWriter(h.MaxBodySize)
+				rr  = withBody(r.WithContext(ctx), reqBody)
 				res *http.Response
 			)
-			next.ServeHTTP(ww, rr)
-			res = ww.Result()
-			p = newPayload(ww.Body.Bytes())
-			p.Header = res.Header
-			p.StatusCode = res.StatusCode
-			if h.AcceptResponse != nil && !h.AcceptResponse(res) {
+			tw.discard = IsDetached(ctx)
+			if streamable && !IsDetached(ctx) {
+				tw.live = live
+				tw.stream = func(code int) bool {
+					// hold back server error if stale response can be served instead
+					stale := staleFromContext(ctx)
+					return !h.HonorCacheControl || !isServerError(code) ||
+						stale == nil || !stale.CanServeStaleIfError()
+				}
+			}
+			if h.Conditional {
+				// full response should be cached regardless of client validators
+				rr = withoutConditionals(rr)
+			}
+			atomic.StoreInt32(&fetched, 1)
+			if err = tw.serve(client, next, h.fillRequest(withoutRange(asGet(rr)))); err != nil {
+				return nil, err
+			}
+			if tw.bypass && tw.discard {
+				return nil, errBypass
+			}
+			res = tw.result()
+			setCookie.Store(res.Header.Values("Set-Cookie"))
+			if p, err = h.newPayload(ctx, r, res, tw.body.Bytes()); err == nil && tw.bypass {
+				// recorded for the client only, such as over limit of a non-streamed response
+				p.Header.Del("Set-Cookie")
 				err = ErrNoCache
+			} else if err == nil {
+				h.encode(p)
+			}
+			if p != nil && h.Conditional {
+				setValidators(p)
 			}
 			return
-		}, h.WaitFor, h.FreshFor, h.TTL); err != nil || p == nil {
-			if h.ErrorHandler != nil {
+		})
+		if live.close() {
+			// response already streamed to client
+			return
+		}
+		if err == errBypass && atomic.LoadInt32(&fetched) == 0 || isHeadMiss(r, d, err) {
+			// response of the merged request bypassed the cache, or HEAD miss
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil && err != errOnlyIfCached && h.ServeStaleOnError {
+			if stale := h.staleLookup(ctx, r, key); stale != nil {
+				stale.Header = stale.Header.Clone()
+				stale.Header.Add("Warning", `111 - "Revalidation Failed"`)
+				p, err = stale, nil
+				status.staleOnError(key)
+			}
+		}
+		if err != nil || p == nil {
+			if err == errOnlyIfCached {
+				w.WriteHeader(http.StatusGatewayTimeout)
+			} else if h.ErrorHandler != nil {
 				h.ErrorHandler(w, r, err)
 			} else if err == context.DeadlineExceeded {
-				w.WriteHeader(http.StatusRequestTimeout)
+				w.WriteHeader(http.StatusGatewayTimeout)
 			} else {
-				w.WriteHeader(http.StatusBadRequest)
+				w.WriteHeader(http.StatusBadGateway)
 			}
 			return
 		}
-		for k, v := range p.Header {
-			w.Header().Set(k, strings.Join(v, ","))
+		p = h.negotiate(r, p)
+		if h.Conditional && p.StatusCode == http.StatusOK && isNotModified(r, p.Header) {
+			h.setStatusHeaders(w.Header(), p, status)
+			writeNotModified(w, p.Header)
+			return
+		}
+		copyHeader(w.Header(), p.Header)
+		h.restoreSetCookie(w.Header(), &setCookie)
+		h.setStatusHeaders(w.Header(), p, status)
+		if p.StatusCode == http.StatusOK && r.Header.Get("Range") != "" {
+			serveRange(w, r, p)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(p.Value)))
+			w.WriteHeader(p.StatusCode)
+			return
 		}
 		w.WriteHeader(p.StatusCode)
 		_, _ = w.Write(p.Value)
 	})
 }
 
+// Shutdown stops new background work, waits for in-flight refreshes
+// and writes until context done, and then closes the cache.
+// The cache is not closed if work is still in flight at context done.
+// HTTP not created by NewHTTP is tracked by its cache adapter,
+// returns ErrNotSupported if the adapter is not comparable
+func (h HTTP) Shutdown(ctx context.Context) error {
+	bg := h.background()
+	if bg == nil {
+		return ErrNotSupported
+	}
+	if err := bg.Shutdown(ctx); err != nil {
+		// cache is left open for the work still in flight
+		return err
+	}
+	return shutdown(ctx, h.Cache)
+}
+
 // RoundTripper wraps and returns a http.RoundTripper for cache
 func (h HTTP) RoundTripper(transport http.RoundTripper) http.RoundTripper {
 	h.Transport = transport
 	return h
 }
 
-// RoundTrip implements http.RoundTripper
+// RoundTrip implements http.RoundTripper.
+// Range requests are fetched and answered with the full response, which is cached
 func (h HTTP) RoundTrip(r *http.Request) (*http.Response, error) {
 	if h.Transport == nil {
 		h.Transport = http.DefaultTransport
 	}
-	var (
-		key = r.URL.String()
-		ctx = r.Context()
-	)
-	if h.AcceptRequest != nil && !h.AcceptRequest(r) {
+	h, r, key, reqBody, ok := h.cacheRequest(r)
+	if !ok {
 		return h.Transport.RoundTrip(r)
 	}
-	if h.RequestKey != nil {
-		key = h.RequestKey(r)
+	var (
+		ctx    = r.Context()
+		status *cacheStatus
+		// origin Set-Cookie if response fetched by this request
+		setCookie atomic.Value
+	)
+	if h.StatusHeaders {
+		status = &cacheStatus{}
+		ctx = withCacheStatus(ctx, status)
 	}
-	p, err := do(ctx, h.Cache, key, func(ctx context.Context) (p *payload, err error) {
+	p, err := h.do(ctx, r, key, h.headDirectives(r, nil), func(ctx context.Context) (p *payload, err error) {
 		var (
-			rr   = r.WithContext(ctx)
+			rr   = withBody(withoutRange(asGet(r.WithContext(ctx))), reqBody)
 			res  *http.Response
 			body []byte
 		)
-		if res, err = h.Transport.RoundTrip(rr); err != nil {
+		stale := staleFromContext(ctx)
+		if revalidate := revalidateRequest(rr, stale); revalidate != nil {
+			// conditional GET with validators of the stale response
+			if res, err = h.Transport.RoundTrip(revalidate); err != nil {
+				return
+			}
+			if res.StatusCode == http.StatusNotModified {
+				_ = res.Body.Close()
+				return h.revalidatedPayload(stale, res)
+			}
+		} else if res, err = h.Transport.RoundTrip(rr); err != nil {
 			return
 		}
 		if body, err = io.ReadAll(res.Body); err != nil {
 			return
 		}
 		res.Body = ioutil.NopCloser(bytes.NewBuffer(body))
-		p = newPayload(body)
-		p.Header = res.Header
-		p.StatusCode = res.StatusCode
-		if h.AcceptResponse != nil && !h.AcceptResponse(res) {
-			err = ErrNoCache
-		}
-		return
-	}, h.WaitFor, h.FreshFor, h.TTL)
+		setCookie.Store(res.Header.Values("Set-Cookie"))
+		return h.newPayload(ctx, r, res, body)
+	})
+	if isHeadMiss(r, nil, err) {
+		return h.Transport.RoundTrip(r)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if p == nil {
 		return nil, ErrNotFound
 	}
-	header := make(http.Header, 0)
-	for k, v := range p.Header {
-		header.Set(k, strings.Join(v, ","))
+	header := make(http.Header, len(p.Header))
+	copyHeader(header, p.Header)
+	h.restoreSetCookie(header, &setCookie)
+	h.setStatusHeaders(header, p, status)
+	var body io.ReadCloser = ioutil.NopCloser(bytes.NewBuffer(p.Value))
+	if r.Method == http.MethodHead {
+		header.Set("Content-Length", strconv.Itoa(len(p.Value)))
+		body = http.NoBody
 	}
 	return &http.Response{
 		Status:        http.StatusText(p.StatusCode),
@@ -181,9 +394,137 @@ func (h HTTP) RoundTrip(r *http.Request) (*http.Response, error) {
 		Proto:         "HTTP/1.1",
 		ProtoMajor:    1,
 		ProtoMinor:    1,
-		Body:          ioutil.NopCloser(bytes.NewBuffer(p.Value)),
+		Body:          body,
 		ContentLength: int64(len(p.Value)),
 		Request:       r,
 		Header:        header,
 	}, nil
 }
+
+// newPayload creates payload from origin response and body,
+// with ErrNoCache if response should not be cached
+func (h HTTP) newPayload(
+	ctx context.Context, r *http.Request, res *http.Response, body []byte,
+) (p *payload, err error) {
+	if h.HonorCacheControl && isServerError(res.StatusCode) {
+		if stale := staleFromContext(ctx); stale != nil && stale.CanServeStaleIfError() {
+			return stale, ErrNoCache
+		}
+	}
+	p = newPayload(body)
+	p.Header = storedHeader(res.Header)
+	p.StatusCode = res.StatusCode
+	defer func() {
+		if err != nil {
+			// uncached response is shared with the requests merged by Race,
+			// cookies are only restored for the request that fetched it
+			p.Header.Del("Set-Cookie")
+		}
+	}()
+	if h.AcceptResponse != nil && !h.AcceptResponse(res) || res.StatusCode == http.StatusPartialContent {
+		// partial content should never be cached as complete response
+		err = ErrNoCache
+		return
+	}
+	if err = h.applySetCookie(p); err != nil {
+		return
+	}
+	if vary := h.varyHeaders(res.Header); len(vary) > 0 {
+		if vary[0] == "*" {
+			err = ErrNoCache
+			return
+		}
+		p.Vary, p.VaryKey = vary, varyKey(r, vary)
+	}
+	if h.HonorCacheControl {
+		err = h.applyCacheControl(p, res.Header)
+	}
+	return
+}
+
+// do wraps the cache call of request key,
+// followed by the variant key if cached response varies from the request
+func (h HTTP) do(
+	ctx context.Context, r *http.Request, key string, d *requestDirectives,
+	fn func(context.Context) (*payload, error),
+) (*payload, error) {
+	c := WithContext(h.Cache)
+	base := h.cacheKey(key)
+	p, err := h.lookup(ctx, c, base, d, h.indexed(base, "", fn))
+	if err != nil || p == nil || h.IgnoreVary || len(p.Vary) == 0 {
+		return p, err
+	}
+	if variant := varyKey(r, p.Vary); variant != p.VaryKey {
+		vkey := h.cacheKey(derivedKey(key, "vary", variant))
+		return h.lookup(ctx, c, vkey, d, h.indexed(vkey, h.cacheKey(variantIndexPrefix+key), fn))
+	}
+	return p, err
+}
+
+// staleLookup returns payload of request key still in cache regardless of freshness,
+// or nil if not found or cached for another variant
+func (h HTTP) staleLookup(ctx context.Context, r *http.Request, key string) *payload {
+	c := WithContext(h.Cache)
+	p, err := parse(c.GetContext(ctx, h.cacheKey(key)))
+	if err != nil {
+		return nil
+	}
+	if h.IgnoreVary || len(p.Vary) == 0 {
+		return p
+	}
+	if variant := varyKey(r, p.Vary); variant != p.VaryKey {
+		if p, err = parse(c.GetContext(ctx, h.cacheKey(derivedKey(key, "vary", variant)))); err != nil {
+			return nil
+		}
+	}
+	return p
+}
+
+// lookup wraps the cache call of key subject to request directives if any
+func (h HTTP) lookup(
+	ctx context.Context, c ContextCache, key string, d *requestDirectives,
+	fn func(context.Context) (*payload, error),
+) (*payload, error) {
+	if d == nil {
+		return do(ctx, c, key, fn, h.WaitFor, h.FreshFor, h.TTL, h.Pool, h.background())
+	}
+	v, err := parse(c.GetContext(ctx, key))
+	switch {
+	case err != nil && d.onlyIfCached:
+		return nil, errOnlyIfCached
+	case err != nil:
+		statusFromContext(ctx).forward(key, "uri-miss")
+		return doCall(ctx, c, key, fn, h.WaitFor, h.FreshFor, h.TTL, h.background())
+	case d.onlyIfCached && !d.servable(v):
+		return nil, errOnlyIfCached
+	case d.onlyIfCached:
+		statusFromContext(ctx).hit(key, v.NeedRefresh(), false)
+		return v, nil
+	case !d.acceptable(v):
+		statusFromContext(ctx).forward(key, "request")
+		return doRevalidate(ctx, c, key, v, fn, h.WaitFor, h.FreshFor, h.TTL, h.background())
+	}
+	return doHit(ctx, c, key, v, fn, h.WaitFor, h.FreshFor, h.TTL, h.Pool, h.background())
+}
+
+// background returns background of HTTP, or of its cache adapter if not created by NewHTTP
+func (h HTTP) background() *background {
+	if h.bg != nil {
+		return h.bg
+	}
+	return cacheBackground(h.Cache)
+}
+
+func (h HTTP) requestKey(r *http.Request) string {
+	if h.RequestKey != nil {
+		return h.RequestKey(r)
+	}
+	return r.URL.String()
+}
+
+func (h HTTP) cacheKey(key string) string {
+	if h.KeyFunc != nil {
+		return h.KeyFunc(key)
+	}
+	return key
+}
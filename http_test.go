@@ -11,6 +11,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -193,3 +194,50 @@ func TestHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTP_ServeStaleOnError(t *testing.T) {
+	var slow int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&slow) == 1 {
+			time.Sleep(time.Millisecond * 50)
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	for _, serveStale := range []bool{false, true} {
+		h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Millisecond*10, time.Minute, time.Hour)
+		h.AcceptRequestCacheControl = func(*http.Request) bool { return true }
+		h.ServeStaleOnError = serveStale
+		h.StatusHeaders = true
+		do := func(url string, noCache bool) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodGet, url, nil)
+			if noCache {
+				r.Header.Set("Cache-Control", "no-cache")
+			}
+			w := httptest.NewRecorder()
+			h.Handler(handler).ServeHTTP(w, r)
+			return w
+		}
+		atomic.StoreInt32(&slow, 1)
+		if w := do("/miss", false); w.Code != http.StatusGatewayTimeout {
+			t.Errorf("timeout = %v, want %v", w.Code, http.StatusGatewayTimeout)
+		}
+		atomic.StoreInt32(&slow, 0)
+		do("/a", false)
+		time.Sleep(time.Millisecond * 10)
+		atomic.StoreInt32(&slow, 1)
+		w := do("/a", true)
+		if !serveStale {
+			if w.Code != http.StatusGatewayTimeout {
+				t.Errorf("timeout = %v, want %v", w.Code, http.StatusGatewayTimeout)
+			}
+		} else if w.Code != http.StatusOK || w.Body.String() != "ok" ||
+			w.Header().Get("Warning") != `111 - "Revalidation Failed"` ||
+			w.Header().Get("X-Cache") != "STALE" ||
+			!strings.Contains(w.Header().Get("Cache-Status"), "hit") ||
+			!strings.Contains(w.Header().Get("Cache-Status"), "detail=stale-on-error") {
+			t.Error(w.Code, w.Body.String(), w.Header(), "should serve stale on error")
+		}
+		time.Sleep(time.Millisecond * 60)
+		atomic.StoreInt32(&slow, 0)
+	}
+}
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"context"
+	"sort"
 	"time"
 )
 
@@ -8,6 +10,8 @@ import (
 type Hybrid struct {
 	Upstream   Cache
 	Downstream Cache
+
+	bg background
 }
 
 // NewHybrid creates Hybrid cache from upstream and downstream
@@ -19,12 +23,21 @@ func NewHybrid(upstream, downstream Cache) *Hybrid {
 }
 
 // Get value by key from downstream, otherwise Fetch from upstream
-func (c *Hybrid) Get(key string) (value []byte, err error) {
-	if val, e := c.Downstream.Get(key); e == nil {
+func (c *Hybrid) Get(key string) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext value by key from downstream, otherwise FetchContext from upstream
+func (c *Hybrid) GetContext(ctx context.Context, key string) (value []byte, err error) {
+	if !c.bg.add() {
+		return nil, ErrShutdown
+	}
+	defer c.bg.done()
+	if val, e := WithContext(c.Downstream).GetContext(ctx, key); e == nil {
 		value = val
 		return
 	}
-	if value, _, err = c.Fetch(key); err != nil {
+	if value, _, err = c.fetch(ctx, key); err != nil {
 		return
 	}
 	return
@@ -32,12 +45,30 @@ func (c *Hybrid) Get(key string) (value []byte, err error) {
 
 // Fetch from upstream and then sync value by
 // Set downstream value the remaining ttl
-func (c *Hybrid) Fetch(key string) (value []byte, ttl time.Duration, err error) {
-	if value, ttl, err = c.Upstream.Fetch(key); err != nil {
+func (c *Hybrid) Fetch(key string) ([]byte, time.Duration, error) {
+	return c.FetchContext(context.Background(), key)
+}
+
+// FetchContext implements the FetchContext method
+func (c *Hybrid) FetchContext(
+	ctx context.Context, key string,
+) (value []byte, ttl time.Duration, err error) {
+	if !c.bg.add() {
+		err = ErrShutdown
+		return
+	}
+	defer c.bg.done()
+	return c.fetch(ctx, key)
+}
+
+func (c *Hybrid) fetch(
+	ctx context.Context, key string,
+) (value []byte, ttl time.Duration, err error) {
+	if value, ttl, err = WithContext(c.Upstream).FetchContext(ctx, key); err != nil {
 		return
 	}
 	if ttl > 0 {
-		if err = c.Downstream.Set(key, value, ttl); err != nil {
+		if err = WithContext(c.Downstream).SetContext(ctx, key, value, ttl); err != nil {
 			return
 		}
 	}
@@ -46,18 +77,109 @@ func (c *Hybrid) Fetch(key string) (value []byte, ttl time.Duration, err error)
 
 // Set implements the Set method
 func (c *Hybrid) Set(key string, value []byte, ttl time.Duration) error {
-	if err := c.Downstream.Set(key, value, ttl); err != nil {
+	return c.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext implements the SetContext method
+func (c *Hybrid) SetContext(
+	ctx context.Context, key string, value []byte, ttl time.Duration,
+) error {
+	if !c.bg.add() {
+		return ErrShutdown
+	}
+	defer c.bg.done()
+	if err := WithContext(c.Downstream).SetContext(ctx, key, value, ttl); err != nil {
 		return err
 	}
-	return c.Upstream.Set(key, value, ttl)
+	return WithContext(c.Upstream).SetContext(ctx, key, value, ttl)
 }
 
 // Del implements the Del method
 func (c *Hybrid) Del(keys ...string) error {
-	if err := c.Downstream.Del(keys...); err != nil {
+	return c.DelContext(context.Background(), keys...)
+}
+
+// DelContext implements the DelContext method
+func (c *Hybrid) DelContext(ctx context.Context, keys ...string) error {
+	if !c.bg.add() {
+		return ErrShutdown
+	}
+	defer c.bg.done()
+	if err := WithContext(c.Downstream).DelContext(ctx, keys...); err != nil {
 		return err
 	}
-	return c.Upstream.Del(keys...)
+	return WithContext(c.Upstream).DelContext(ctx, keys...)
+}
+
+// DelPrefix implements the PrefixCache interface on downstream and upstream,
+// returns ErrNotSupported if either tier does not support deletion by prefix
+func (c *Hybrid) DelPrefix(ctx context.Context, prefix string) error {
+	if !c.bg.add() {
+		return ErrShutdown
+	}
+	defer c.bg.done()
+	if err := delPrefix(ctx, c.Downstream, prefix); err != nil {
+		return err
+	}
+	return delPrefix(ctx, c.Upstream, prefix)
+}
+
+// AddIndex implements the IndexCache interface on upstream if supported,
+// otherwise on both tiers under in-process lock of index
+func (c *Hybrid) AddIndex(ctx context.Context, index string, ttl time.Duration, keys ...string) error {
+	if !c.bg.add() {
+		return ErrShutdown
+	}
+	defer c.bg.done()
+	if ic, ok := c.Upstream.(IndexCache); ok {
+		return ic.AddIndex(ctx, index, ttl, keys...)
+	}
+	mu := indexLock(index)
+	mu.Lock()
+	defer mu.Unlock()
+	return mergeIndex(ctx, c, index, ttl, keys...)
+}
+
+// IndexKeys implements the IndexCache interface on upstream if supported,
+// otherwise from the index entry of both tiers
+func (c *Hybrid) IndexKeys(ctx context.Context, index string) ([]string, error) {
+	if ic, ok := c.Upstream.(IndexCache); ok {
+		return ic.IndexKeys(ctx, index)
+	}
+	return fetchIndex(ctx, c, index)
+}
+
+// Keys implements the KeysCache interface by merging keys of downstream and upstream,
+// skipping the tier not supporting listing keys
+func (c *Hybrid) Keys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	var (
+		seen = map[string]bool{}
+		keys []string
+	)
+	for _, tier := range []Cache{c.Downstream, c.Upstream} {
+		kc, ok := tier.(KeysCache)
+		if !ok {
+			continue
+		}
+		res, err := kc.Keys(ctx, prefix, limit)
+		if err == ErrNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range res {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
 }
 
 // Clear implements the Clear method
@@ -76,12 +198,38 @@ func (c *Hybrid) Close() error {
 	return c.Upstream.Close()
 }
 
+// Shutdown stops accepting new operations, waits for in-flight ones
+// until context done, and then closes downstream and upstream.
+// Tiers are not closed if operations are still in flight at context done
+func (c *Hybrid) Shutdown(ctx context.Context) error {
+	if err := c.bg.Shutdown(ctx); err != nil {
+		// tiers are left open for the operations still in flight
+		return err
+	}
+	err := shutdown(ctx, c.Downstream)
+	if e := shutdown(ctx, c.Upstream); err == nil {
+		err = e
+	}
+	return err
+}
+
 // Race implements the Race method by first acquiring downstream and then upstream
 func (c *Hybrid) Race(
 	key string, fn func() ([]byte, error), timeout, ttl time.Duration,
 ) ([]byte, error) {
+	return c.RaceContext(context.Background(), key, fn, timeout, ttl)
+}
+
+// RaceContext implements the RaceContext method by first acquiring downstream and then upstream
+func (c *Hybrid) RaceContext(
+	ctx context.Context, key string, fn func() ([]byte, error), timeout, ttl time.Duration,
+) ([]byte, error) {
+	if !c.bg.add() {
+		return nil, ErrShutdown
+	}
+	defer c.bg.done()
 	start := time.Now()
-	return c.Downstream.Race(key, func() ([]byte, error) {
-		return c.Upstream.Race(key, fn, timeout-time.Since(start), ttl)
+	return WithContext(c.Downstream).RaceContext(ctx, key, func() ([]byte, error) {
+		return WithContext(c.Upstream).RaceContext(ctx, key, fn, timeout-time.Since(start), ttl)
 	}, timeout, ttl)
 }
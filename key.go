@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// KeyFunc transforms cache key before reaching the cache adaptor
+type KeyFunc func(key string) string
+
+// hashKeyLen length of the hashed key suffix, separator and hex sha256 digest
+const hashKeyLen = 1 + sha256.Size*2
+
+var keyEscaper = strings.NewReplacer(
+	"%", "%25",
+	"*", "%2A",
+	"?", "%3F",
+	"[", "%5B",
+	"]", "%5D",
+	"\\", "%5C",
+)
+
+var globEscaper = strings.NewReplacer(
+	"*", "\\*",
+	"?", "\\?",
+	"[", "\\[",
+	"]", "\\]",
+	"\\", "\\\\",
+)
+
+// EscapeKey percent-encodes glob metacharacters of key,
+// so that keys are safe to be matched by redis SCAN MATCH pattern
+func EscapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+// HashKey returns KeyFunc that hashes keys longer than maxLen,
+// keeping a readable prefix of the key followed by its sha256 hex digest
+// within maxLen total length. maxLen should be greater than 65
+// for the readable prefix to remain
+func HashKey(maxLen int) KeyFunc {
+	return func(key string) string {
+		if maxLen <= 0 || len(key) <= maxLen {
+			return key
+		}
+		sum := sha256.Sum256([]byte(key))
+		n := maxLen - hashKeyLen
+		if n < 0 {
+			n = 0
+		}
+		// readable prefix should not split a multi-byte character
+		for n > 0 && !utf8.RuneStart(key[n]) {
+			n--
+		}
+		return key[:n] + "~" + hex.EncodeToString(sum[:])
+	}
+}
+
+// SafeKey returns KeyFunc that escapes glob metacharacters and
+// hashes keys longer than maxLen
+func SafeKey(maxLen int) KeyFunc {
+	return ChainKey(EscapeKey, HashKey(maxLen))
+}
+
+// ChainKey returns KeyFunc that applies fns in order
+func ChainKey(fns ...KeyFunc) KeyFunc {
+	return func(key string) string {
+		for _, fn := range fns {
+			if fn != nil {
+				key = fn(key)
+			}
+		}
+		return key
+	}
+}
+
+// escapeGlob escapes glob metacharacters for redis SCAN MATCH pattern
+func escapeGlob(s string) string {
+	return globEscaper.Replace(s)
+}
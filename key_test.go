@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeKey(t *testing.T) {
+	long := strings.Repeat("a", 200)
+	tests := []struct {
+		name   string
+		fn     KeyFunc
+		key    string
+		want   string
+		prefix string
+		maxLen int
+	}{
+		{
+			name: "should keep short key",
+			fn:   SafeKey(100),
+			key:  "foo:bar",
+			want: "foo:bar",
+		},
+		{
+			name: "should escape glob metacharacters",
+			fn:   SafeKey(100),
+			key:  `http://a/?q=[a*b?]\%`,
+			want: `http://a/%3Fq=%5Ba%2Ab%3F%5D%5C%25`,
+		},
+		{
+			name:   "should hash long key with readable prefix",
+			fn:     SafeKey(100),
+			key:    long,
+			prefix: strings.Repeat("a", 35) + "~",
+			maxLen: 100,
+		},
+		{
+			name:   "should not split multi-byte character",
+			fn:     HashKey(70),
+			key:    "aaaa" + strings.Repeat("中", 50),
+			prefix: "aaaa~",
+			maxLen: 70,
+		},
+		{
+			name: "should chain key functions",
+			fn: ChainKey(nil, func(key string) string {
+				return "x:" + key
+			}, EscapeKey),
+			key:  "*",
+			want: "x:%2A",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.fn(tt.key)
+			if tt.want != "" && got != tt.want {
+				t.Errorf(" = %v, want %v", got, tt.want)
+			}
+			if tt.prefix != "" && !strings.HasPrefix(got, tt.prefix) {
+				t.Errorf(" = %v, want prefix %v", got, tt.prefix)
+			}
+			if tt.maxLen > 0 && len(got) > tt.maxLen {
+				t.Errorf(" = %v, want max length %v", len(got), tt.maxLen)
+			}
+			if got2 := tt.fn(tt.key); got != got2 {
+				t.Errorf(" = %v, want deterministic %v", got2, got)
+			}
+		})
+	}
+	if HashKey(100)(long) == HashKey(100)(long+"b") {
+		t.Error("should hash into different keys")
+	}
+}
+
+func TestFunc_KeyFunc(t *testing.T) {
+	var (
+		c   = NewMemory(10, int64(10<<20), -1)
+		fn  = NewFunc(c, time.Second, time.Minute, time.Minute)
+		key = strings.Repeat("k", 200) + "*"
+		val string
+	)
+	fn.KeyFunc = SafeKey(100)
+	if err := fn.Do(context.Background(), key, func(ctx context.Context) (interface{}, error) {
+		return "v", nil
+	}, &val); err != nil || val != "v" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if _, err := c.Get(key); err != ErrNotFound {
+		t.Error(err, "should not store raw key")
+	}
+	if _, err := c.Get(SafeKey(100)(key)); err != nil {
+		t.Error(err, "should store transformed key")
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err, "error closing cache")
+	}
+}
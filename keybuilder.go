@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TrackingParams query parameters of campaign tracking, denied by NewKeyBuilder
+var TrackingParams = []string{
+	"utm_*", "gclid", "dclid", "fbclid", "msclkid", "mc_cid", "mc_eid", "_ga", "_gl",
+}
+
+// KeyBuilder builds normalized cache keys of requests,
+// so that equivalent URLs share a cache entry.
+// Query parameters are sorted, use RequestKey as HTTP RequestKey
+type KeyBuilder struct {
+	// Scheme includes the request scheme in key
+	Scheme bool
+
+	// Host includes the lowercased request host in key, without default port
+	Host bool
+
+	// TrimSlash removes trailing slash of path other than root
+	TrimSlash bool
+
+	// AllowQuery query parameters kept in key in path.Match syntax,
+	// by default all parameters not denied are kept
+	AllowQuery []string
+
+	// DenyQuery query parameters dropped from key in path.Match syntax
+	DenyQuery []string
+
+	// Headers request headers included in key
+	Headers []string
+
+	// Cookies request cookies included in key
+	Cookies []string
+
+	// Hash replaces key with its hex sha256 of fixed length.
+	// Hashed keys can not be purged by prefix
+	Hash bool
+}
+
+// NewKeyBuilder creates KeyBuilder denying TrackingParams with trailing slash trimmed
+func NewKeyBuilder() *KeyBuilder {
+	return &KeyBuilder{
+		TrimSlash: true,
+		DenyQuery: TrackingParams,
+	}
+}
+
+// RequestKey returns normalized cache key of request
+func (b *KeyBuilder) RequestKey(r *http.Request) string {
+	var key strings.Builder
+	scheme := requestScheme(r)
+	if b.Scheme {
+		key.WriteString(scheme + ":")
+	}
+	if b.Host {
+		key.WriteString("//" + requestHost(r, scheme))
+	}
+	p := r.URL.EscapedPath()
+	if b.TrimSlash && len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+		if p == "" {
+			p = "/"
+		}
+	}
+	key.WriteString(p)
+	if query := b.query(r.URL.Query()); len(query) > 0 {
+		// Encode sorts by key
+		key.WriteString("?" + query.Encode())
+	}
+	if len(b.Headers) > 0 {
+		names := append([]string(nil), b.Headers...)
+		sort.Strings(names)
+		for _, name := range names {
+			key.WriteString(headerKey(r.Header, name))
+		}
+	}
+	if len(b.Cookies) > 0 {
+		names := append([]string(nil), b.Cookies...)
+		sort.Strings(names)
+		for _, name := range names {
+			var value string
+			if c, err := r.Cookie(name); err == nil {
+				value = c.Value
+			}
+			key.WriteString("#cookie:" + url.QueryEscape(name) + "=" + url.QueryEscape(value))
+		}
+	}
+	if b.Hash {
+		sum := sha256.Sum256([]byte(key.String()))
+		return hex.EncodeToString(sum[:])
+	}
+	return key.String()
+}
+
+// headerKey returns cache key segment of all values of header name,
+// escaped so that segments of different values do not collide
+func headerKey(header http.Header, name string) string {
+	values := header.Values(name)
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = url.QueryEscape(v)
+	}
+	return "#" + http.CanonicalHeaderKey(name) + ":" + strings.Join(escaped, ",")
+}
+
+// query returns query parameters allowed and not denied
+func (b *KeyBuilder) query(query url.Values) url.Values {
+	for name := range query {
+		if len(b.AllowQuery) > 0 && !matchAny(b.AllowQuery, name) || matchAny(b.DenyQuery, name) {
+			delete(query, name)
+		}
+	}
+	return query
+}
+
+// matchAny returns if name matches any of the path.Match patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func requestScheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return strings.ToLower(r.URL.Scheme)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestHost returns lowercased host of request without default port of scheme
+func requestHost(r *http.Request, scheme string) string {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil &&
+		(scheme == "http" && port == "80" || scheme == "https" && port == "443") {
+		host = h
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *KeyBuilder
+		url     string
+		header  http.Header
+		want    string
+	}{
+		{"sort query", &KeyBuilder{}, "http://foo.bar/a?b=2&a=1&b=1", nil, "/a?a=1&b=2&b=1"},
+		{"tracking params", NewKeyBuilder(), "http://foo.bar/a/?utm_source=x&q=1&gclid=y", nil, "/a?q=1"},
+		{"trim slash", NewKeyBuilder(), "http://foo.bar/a//", nil, "/a"},
+		{"root", NewKeyBuilder(), "http://foo.bar/", nil, "/"},
+		{"allow query", &KeyBuilder{AllowQuery: []string{"page", "f_*"}},
+			"http://foo.bar/a?page=1&f_x=2&sort=a", nil, "/a?f_x=2&page=1"},
+		{"allow and deny", &KeyBuilder{AllowQuery: []string{"f_*"}, DenyQuery: []string{"f_debug"}},
+			"http://foo.bar/a?f_x=2&f_debug=1", nil, "/a?f_x=2"},
+		{"host", &KeyBuilder{Host: true}, "http://FOO.bar:80/a", nil, "//foo.bar/a"},
+		{"scheme and host", &KeyBuilder{Scheme: true, Host: true}, "https://foo.bar:8443/a", nil,
+			"https://foo.bar:8443/a"},
+		{"headers and cookies", &KeyBuilder{Headers: []string{"x-tenant", "Accept-Language"}, Cookies: []string{"ab"}},
+			"http://foo.bar/a", http.Header{"X-Tenant": {"t1"}, "Cookie": {"ab=b; session=s"}},
+			"/a#Accept-Language:#X-Tenant:t1#cookie:ab=b"},
+		{"escaped values", &KeyBuilder{Headers: []string{"X-Tenant"}, Cookies: []string{"ab"}},
+			"http://foo.bar/a", http.Header{"X-Tenant": {"t1#cookie:ab=b"}, "Cookie": {`ab="b#c"`}},
+			"/a#X-Tenant:t1%23cookie%3Aab%3Db#cookie:ab=b%23c"},
+		{"multiple values", &KeyBuilder{Headers: []string{"X-Tenant"}},
+			"http://foo.bar/a", http.Header{"X-Tenant": {"t1", "t2,t3"}}, "/a#X-Tenant:t1,t2%2Ct3"},
+		{"hash", &KeyBuilder{Hash: true}, "http://foo.bar/a", nil,
+			"6a50dc8584134c7de537c0052ff6d236bf874355e050c90523e0c5ff2a543a28"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		for k, v := range tt.header {
+			r.Header[k] = v
+		}
+		got := tt.builder.RequestKey(r)
+		if got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHTTP_KeyBuilder(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.RequestKey = NewKeyBuilder().RequestKey
+	for _, url := range []string{
+		"http://foo.bar/a?x=1&y=2",
+		"http://foo.bar/a/?y=2&x=1",
+		"http://foo.bar/a?utm_campaign=c&y=2&x=1&fbclid=f",
+	} {
+		h.Handler(handler).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, url, nil))
+		time.Sleep(time.Millisecond * 10)
+	}
+	if counter != 1 {
+		t.Errorf("counter = %v, equivalent URLs should share cache entry", counter)
+	}
+}
@@ -1,10 +1,16 @@
 package cache
 
 import (
+	"context"
+	"fmt"
 	"golang.org/x/sync/singleflight"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgraph-io/ristretto"
+	"github.com/dgraph-io/ristretto/z"
 )
 
 // Memory cache adaptor based on ristretto
@@ -16,28 +22,47 @@ type Memory struct {
 
 	// MaxTTL bounded maximum ttl
 	MaxTTL time.Duration
+
+	// keys index of key hash to key, for listing keys,
+	// bounded by maxKeys
+	mu      sync.Mutex
+	keys    map[uint64]string
+	maxKeys int
 }
 
 // NewMemory creates an in-memory cache with an upper bound for
 // maxItems total number of items, maxSize total byte size
 // maxTTL max ttl of each item
 func NewMemory(maxItems, maxSize int64, maxTTL time.Duration) *Memory {
+	m := &Memory{
+		MaxTTL:  maxTTL,
+		keys:    map[uint64]string{},
+		maxKeys: int(maxItems * 10),
+	}
 	c, err := ristretto.NewCache(&ristretto.Config{
 		NumCounters: maxItems * 10,
 		MaxCost:     maxSize,
 		BufferItems: 64,
+		OnEvict:     m.unindex,
+		OnReject:    m.unindex,
 	})
 	if err != nil {
 		panic(err)
 	}
-	return &Memory{
-		Cache:  c,
-		MaxTTL: maxTTL,
-	}
+	m.Cache = c
+	return m
 }
 
 // Get implements the Get method
 func (c *Memory) Get(key string) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext implements the GetContext method
+func (c *Memory) GetContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if res, ok := c.Cache.Get(key); ok {
 		if res != nil {
 			return res.([]byte), nil
@@ -49,7 +74,14 @@ func (c *Memory) Get(key string) ([]byte, error) {
 
 // Fetch get value and remaining ttl by key
 func (c *Memory) Fetch(key string) (value []byte, ttl time.Duration, err error) {
-	if value, err = c.Get(key); err != nil {
+	return c.FetchContext(context.Background(), key)
+}
+
+// FetchContext implements the FetchContext method
+func (c *Memory) FetchContext(
+	ctx context.Context, key string,
+) (value []byte, ttl time.Duration, err error) {
+	if value, err = c.GetContext(ctx, key); err != nil {
 		return
 	}
 	ttl, _ = c.Cache.GetTTL(key)
@@ -58,17 +90,40 @@ func (c *Memory) Fetch(key string) (value []byte, ttl time.Duration, err error)
 
 // Set implements the Set method
 func (c *Memory) Set(key string, value []byte, ttl time.Duration) error {
+	return c.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext implements the SetContext method
+func (c *Memory) SetContext(
+	ctx context.Context, key string, value []byte, ttl time.Duration,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if c.MaxTTL > 0 && ttl > c.MaxTTL {
 		ttl = c.MaxTTL
 	}
-	c.Cache.SetWithTTL(key, value, int64(len(value)), ttl)
+	// indexed before set, so that rejection by the cache policy unindexes it
+	c.index(key)
+	if !c.Cache.SetWithTTL(key, value, int64(len(value)), ttl) {
+		c.unindexKey(key)
+	}
 	return nil
 }
 
 // Del implements the Del method
 func (c *Memory) Del(keys ...string) error {
+	return c.DelContext(context.Background(), keys...)
+}
+
+// DelContext implements the DelContext method
+func (c *Memory) DelContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for _, key := range keys {
 		c.Cache.Del(key)
+		c.unindexKey(key)
 	}
 	return nil
 }
@@ -76,9 +131,92 @@ func (c *Memory) Del(keys ...string) error {
 // Clear implements the Clear method
 func (c *Memory) Clear() error {
 	c.Cache.Clear()
+	c.mu.Lock()
+	if c.keys != nil {
+		c.keys = map[uint64]string{}
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// Keys implements the KeysCache interface from the key index,
+// which is only available for Memory created by NewMemory.
+// Keys beyond 10 times maxItems of NewMemory are not indexed
+func (c *Memory) Keys(ctx context.Context, prefix string, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var keys []string
+	c.mu.Lock()
+	for _, key := range c.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+// DelPrefix implements the PrefixCache interface from the key index,
+// returns ErrNotSupported if key index not available
+func (c *Memory) DelPrefix(ctx context.Context, prefix string) error {
+	c.mu.Lock()
+	indexed := c.keys != nil
+	c.mu.Unlock()
+	if !indexed {
+		return ErrNotSupported
+	}
+	keys, err := c.Keys(ctx, prefix, 0)
+	if err != nil {
+		return err
+	}
+	return c.DelContext(ctx, keys...)
+}
+
+// AddIndex implements the IndexCache interface under in-process lock of index,
+// waiting for the entry to be visible before releasing the lock
+func (c *Memory) AddIndex(ctx context.Context, index string, ttl time.Duration, keys ...string) error {
+	mu := indexLock(index)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := mergeIndex(ctx, c, index, ttl, keys...); err != nil {
+		return err
+	}
+	c.Cache.Wait()
 	return nil
 }
 
+// IndexKeys implements the IndexCache interface
+func (c *Memory) IndexKeys(ctx context.Context, index string) ([]string, error) {
+	return fetchIndex(ctx, c, index)
+}
+
+func (c *Memory) index(key string) {
+	hash, _ := z.KeyToHash(key)
+	c.mu.Lock()
+	if _, ok := c.keys[hash]; ok || (c.keys != nil && len(c.keys) < c.maxKeys) {
+		c.keys[hash] = key
+	}
+	c.mu.Unlock()
+}
+
+func (c *Memory) unindexKey(key string) {
+	hash, _ := z.KeyToHash(key)
+	c.mu.Lock()
+	delete(c.keys, hash)
+	c.mu.Unlock()
+}
+
+func (c *Memory) unindex(item *ristretto.Item) {
+	c.mu.Lock()
+	delete(c.keys, item.Key)
+	c.mu.Unlock()
+}
+
 // Close implements the Close method
 func (c *Memory) Close() error {
 	c.Cache.Close()
@@ -87,8 +225,38 @@ func (c *Memory) Close() error {
 
 // Race implements the Race method using singleflight
 func (c *Memory) Race(
-	key string, fn func() ([]byte, error), _, _ time.Duration,
+	key string, fn func() ([]byte, error), waitFor, ttl time.Duration,
+) ([]byte, error) {
+	return c.RaceContext(context.Background(), key, fn, waitFor, ttl)
+}
+
+// RaceContext implements the RaceContext method using singleflight
+func (c *Memory) RaceContext(
+	ctx context.Context, key string, fn func() ([]byte, error), _, _ time.Duration,
 ) ([]byte, error) {
+	if ctx.Done() == nil {
+		return c.race(key, fn)
+	}
+	ch := c.g.DoChan(key, func() (v interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		return fn()
+	})
+	select {
+	case res := <-ch:
+		if res.Val != nil {
+			return res.Val.([]byte), res.Err
+		}
+		return nil, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Memory) race(key string, fn func() ([]byte, error)) ([]byte, error) {
 	v, err, _ := c.g.Do(key, func() (interface{}, error) {
 		return fn()
 	})
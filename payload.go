@@ -1,11 +1,35 @@
 package cache
 
 import (
+	"errors"
 	"net/http"
 	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
 )
 
-const v = 1
+// payloadVersion current version of payload envelope.
+//
+// Adding payload fields does not require a version bump,
+// as unknown fields are skipped and missing fields left zero on decode.
+// Bump the version only for incompatible changes,
+// with a migration registered from the previous version
+const payloadVersion = 2
+
+// payloadMagic leading byte of payload envelope,
+// a byte never used by msgpack so legacy payloads are distinguishable
+const payloadMagic byte = 0xc1
+
+// payloadHeaderLen length of envelope header: magic, version and codec id
+const payloadHeaderLen = 3
+
+var errPayloadCodec = errors.New("hybridcache: unknown payload codec")
+
+// payloadMigrations migrates payload from the keyed version to the next version
+var payloadMigrations = map[int]func(*payload) error{
+	// version 1 msgpack payload without envelope, same fields
+	1: func(*payload) error { return nil },
+}
 
 type payload struct {
 	_msgpack   struct{} `msgpack:",omitempty"`
@@ -13,13 +37,36 @@ type payload struct {
 	Value      []byte
 	Header     http.Header
 	StatusCode int
-	V          int
+	// V version of payload, read from envelope header,
+	// or from the body of legacy payloads without envelope
+	V     int
+	Codec byte
+
+	// StaleUntil time until stale payload can be served while refreshing
+	// in background, zero for no bound
+	StaleUntil time.Time
+
+	// StaleIfError time until stale payload can be served if refresh failed
+	StaleIfError time.Time
+
+	// Vary normalized request header names the response varies on
+	Vary []string
+
+	// VaryKey normalized request header values of the response
+	VaryKey string
+
+	// Created time the payload was generated, zero if unknown
+	Created time.Time
+
+	// ttl overrides the ttl of client when set
+	ttl time.Duration
 }
 
 func newPayload(value []byte) *payload {
 	return &payload{
-		Value: value,
-		V:     v,
+		Value:   value,
+		V:       payloadVersion,
+		Created: time.Now(),
 	}
 }
 
@@ -32,6 +79,61 @@ func (p *payload) NeedRefresh() bool {
 	return time.Now().After(p.BestBefore)
 }
 
+// CanServeStale returns if stale payload can be served while refreshing in background
+func (p *payload) CanServeStale() bool {
+	return p.StaleUntil.IsZero() || time.Now().Before(p.StaleUntil)
+}
+
+// CanServeStaleIfError returns if stale payload can be served if refresh failed
+func (p *payload) CanServeStaleIfError() bool {
+	return time.Now().Before(p.StaleIfError)
+}
+
+// IsValid returns if payload is of current version,
+// newer versions are incompatible by contract and not readable
 func (p *payload) IsValid() bool {
-	return p.V == v
+	return p.V == payloadVersion
+}
+
+// marshalPayload encodes payload into envelope of current version,
+// where the version is kept by envelope header only
+func marshalPayload(p *payload) ([]byte, error) {
+	body := *p
+	body.V = 0
+	b, err := CodecMsgpack.Marshal(&body)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{payloadMagic, payloadVersion, CodecMsgpack.ID()}, b...), nil
+}
+
+// unmarshalPayload decodes payload from envelope or legacy msgpack,
+// migrating older versions to the current version
+func unmarshalPayload(b []byte, p *payload) (err error) {
+	if len(b) >= payloadHeaderLen && b[0] == payloadMagic {
+		codec, ok := LookupCodec(b[2])
+		if !ok {
+			return errPayloadCodec
+		}
+		if err = codec.Unmarshal(b[payloadHeaderLen:], p); err != nil {
+			return
+		}
+		p.V = int(b[1])
+	} else if err = msgpack.Unmarshal(b, p); err != nil {
+		return
+	}
+	for p.V > 0 && p.V < payloadVersion {
+		migrate, ok := payloadMigrations[p.V]
+		if !ok {
+			return ErrNotFound
+		}
+		if err = migrate(p); err != nil {
+			return
+		}
+		p.V++
+	}
+	if !p.IsValid() {
+		return ErrNotFound
+	}
+	return
 }
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestPayload_Envelope(t *testing.T) {
+	bestBefore := time.Now().Add(time.Minute).Round(time.Millisecond)
+	p := newPayload([]byte("a"))
+	p.BestBefore = bestBefore
+	p.StatusCode = 200
+	b, err := unparse(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != payloadMagic || b[1] != payloadVersion || b[2] != CodecMsgpack.ID() {
+		t.Errorf("unexpected envelope header %v", b[:payloadHeaderLen])
+	}
+	res, err := parse(b, nil)
+	if err != nil || string(res.Value) != "a" || res.StatusCode != 200 || !res.BestBefore.Equal(bestBefore) {
+		t.Error(res, err, "should decode envelope")
+	}
+
+	legacy, _ := msgpack.Marshal(&payload{Value: []byte("b"), BestBefore: bestBefore, V: 1})
+	if res, err := parse(legacy, nil); err != nil || string(res.Value) != "b" || res.V != payloadVersion {
+		t.Error(res, err, "should migrate legacy payload")
+	}
+
+	var fields map[string]interface{}
+	if err := msgpack.Unmarshal(b[payloadHeaderLen:], &fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fields["V"]; ok {
+		t.Error("version should be stored in envelope header only")
+	}
+
+	added, _ := msgpack.Marshal(&struct {
+		Value    []byte
+		NewField string
+	}{[]byte("c"), "foo"})
+	added = append([]byte{payloadMagic, payloadVersion, CodecMsgpack.ID()}, added...)
+	if res, err := parse(added, nil); err != nil || string(res.Value) != "c" {
+		t.Error(res, err, "should decode added fields")
+	}
+
+	newer := append([]byte{payloadMagic, payloadVersion + 1, CodecMsgpack.ID()}, b[payloadHeaderLen:]...)
+	if res, err := parse(newer, nil); err != ErrNotFound || res != nil {
+		t.Error(res, err, "should not found incompatible newer version")
+	}
+
+	unknown := append([]byte{payloadMagic, payloadVersion, 255}, b[payloadHeaderLen:]...)
+	if res, err := parse(unknown, nil); err != ErrNotFound || res != nil {
+		t.Error(res, err, "should not found unknown codec")
+	}
+
+	unsupported, _ := msgpack.Marshal(&payload{Value: []byte("d"), V: -1})
+	if res, err := parse(unsupported, nil); err != ErrNotFound || res != nil {
+		t.Error(res, err, "should not found version without migration")
+	}
+
+	if res, err := parse([]byte("corrupted"), nil); err != ErrNotFound || res != nil {
+		t.Error(res, err, "should not found corrupted payload")
+	}
+}
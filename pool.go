@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"sync"
+)
+
+// OverflowPolicy decides how Pool handles submissions when its queue is full
+type OverflowPolicy int
+
+const (
+	// DropNewest discards the incoming submission
+	DropNewest OverflowPolicy = iota
+
+	// DropOldest discards the oldest queued submission in favour of the incoming one
+	DropOldest
+
+	// Block waits until the queue has room for the incoming submission
+	Block
+)
+
+// PoolStats metrics of the Pool
+type PoolStats struct {
+	// Workers number of workers
+	Workers int
+
+	// Queued number of submissions waiting in queue
+	Queued int
+
+	// Running number of submissions being executed
+	Running int
+
+	// Submitted total number of submissions
+	Submitted uint64
+
+	// Merged total number of submissions merged into a queued or running one of the same key
+	Merged uint64
+
+	// Dropped total number of submissions dropped by overflow
+	Dropped uint64
+
+	// Completed total number of executed submissions
+	Completed uint64
+}
+
+// Pool bounded worker pool with a queue for background refreshes.
+// Submissions of the same key are merged while queued or running
+type Pool struct {
+	// Overflow policy when queue is full, default DropNewest
+	Overflow OverflowPolicy
+
+	workers   int
+	queueSize int
+	mu        sync.Mutex
+	cond      *sync.Cond
+	wg        sync.WaitGroup
+	queue     []poolJob
+	keys      map[string]struct{}
+	closed    bool
+	stats     PoolStats
+}
+
+type poolJob struct {
+	key  string
+	fn   func()
+	drop func()
+}
+
+// NewPool creates worker pool with number of workers and the queue size
+func NewPool(workers, queueSize int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	p := &Pool{
+		workers:   workers,
+		queueSize: queueSize,
+		keys:      map[string]struct{}{},
+	}
+	p.cond = sync.NewCond(&p.mu)
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn under key for execution, returns if fn is queued.
+// Submission is merged and fn discarded
+// if the same key is already queued or running
+func (p *Pool) Submit(key string, fn func()) bool {
+	return p.submit(key, fn, nil)
+}
+
+// submit queues fn under key, where drop is called
+// if fn is queued but later evicted by DropOldest
+func (p *Pool) submit(key string, fn, drop func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Submitted++
+	if p.closed {
+		p.stats.Dropped++
+		return false
+	}
+	if _, ok := p.keys[key]; ok {
+		p.stats.Merged++
+		return false
+	}
+	for len(p.queue) >= p.queueSize {
+		switch p.Overflow {
+		case Block:
+			p.cond.Wait()
+			if p.closed {
+				p.stats.Dropped++
+				return false
+			}
+			if _, ok := p.keys[key]; ok {
+				p.stats.Merged++
+				return false
+			}
+			continue
+		case DropOldest:
+			if len(p.queue) > 0 {
+				oldest := p.queue[0]
+				delete(p.keys, oldest.key)
+				p.queue = p.queue[1:]
+				p.stats.Dropped++
+				if oldest.drop != nil {
+					oldest.drop()
+				}
+				continue
+			}
+		}
+		p.stats.Dropped++
+		return false
+	}
+	p.keys[key] = struct{}{}
+	p.queue = append(p.queue, poolJob{key: key, fn: fn, drop: drop})
+	p.cond.Broadcast()
+	return true
+}
+
+// Stats returns the current metrics of the pool
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Workers = p.workers
+	stats.Queued = len(p.queue)
+	return stats
+}
+
+// Close stops accepting submissions and waits for the queued ones to complete
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		job := p.queue[0]
+		p.queue = p.queue[1:]
+		p.stats.Running++
+		p.cond.Broadcast()
+		p.mu.Unlock()
+
+		p.run(job.fn)
+
+		p.mu.Lock()
+		delete(p.keys, job.key)
+		p.stats.Running--
+		p.stats.Completed++
+		p.mu.Unlock()
+	}
+}
+
+func (p *Pool) run(fn func()) {
+	defer func() {
+		_ = recover()
+	}()
+	fn()
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	var (
+		p       = NewPool(2, 3)
+		release = make(chan struct{})
+		running int32
+		maxRun  int32
+		called  int32
+	)
+	fn := func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRun)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRun, m, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&called, 1)
+		atomic.AddInt32(&running, -1)
+	}
+	for i := 0; i < 2; i++ {
+		if !p.Submit(strconv.Itoa(i), fn) {
+			t.Error("should submit")
+		}
+	}
+	time.Sleep(time.Millisecond * 10)
+	for i := 2; i < 5; i++ {
+		if !p.Submit(strconv.Itoa(i), fn) {
+			t.Error("should queue")
+		}
+	}
+	if p.Submit("0", fn) || p.Submit("4", fn) {
+		t.Error("should merge duplicate keys")
+	}
+	if p.Submit("5", fn) {
+		t.Error("should drop on overflow")
+	}
+	stats := p.Stats()
+	if stats.Running != 2 || stats.Queued != 3 || stats.Merged != 2 || stats.Dropped != 1 || stats.Submitted != 8 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	close(release)
+	p.Close()
+	if n := atomic.LoadInt32(&called); n != 5 {
+		t.Errorf(" = %v, want %v", n, 5)
+	}
+	if n := atomic.LoadInt32(&maxRun); n != 2 {
+		t.Errorf(" = %v, want %v, should bound concurrency", n, 2)
+	}
+	if stats := p.Stats(); stats.Completed != 5 {
+		t.Errorf(" = %v, want %v", stats.Completed, 5)
+	}
+	if p.Submit("6", fn) {
+		t.Error("should drop after close")
+	}
+}
+
+func TestPool_DropOldest(t *testing.T) {
+	var (
+		p       = NewPool(1, 1)
+		release = make(chan struct{})
+		called  = make(chan string, 10)
+	)
+	p.Overflow = DropOldest
+	p.Submit("a", func() {
+		<-release
+		called <- "a"
+	})
+	time.Sleep(time.Millisecond * 10)
+	p.Submit("b", func() { called <- "b" })
+	p.Submit("c", func() { called <- "c" })
+	close(release)
+	p.Close()
+	close(called)
+	var res string
+	for k := range called {
+		res += k
+	}
+	if res != "ac" {
+		t.Errorf(" = %v, want %v", res, "ac")
+	}
+}
+
+func TestFunc_Pool(t *testing.T) {
+	var (
+		c      = NewMemory(10, int64(10<<20), -1)
+		fn     = NewFunc(c, time.Second, time.Millisecond*10, time.Second)
+		ctx    = context.Background()
+		called int32
+		val    string
+	)
+	fn.Pool = NewPool(1, 10)
+	call := func(ctx context.Context) (interface{}, error) {
+		time.Sleep(time.Millisecond * 20)
+		return strconv.Itoa(int(atomic.AddInt32(&called, 1))), nil
+	}
+	if err := fn.Do(ctx, "a", call, &val); err != nil || val != "1" {
+		t.Error(val, err)
+	}
+	time.Sleep(time.Millisecond * 20)
+	for i := 0; i < 10; i++ {
+		if err := fn.Do(ctx, "a", call, &val); err != nil || val != "1" {
+			t.Error(val, err, "should serve stale")
+		}
+	}
+	fn.Pool.Close()
+	if n := atomic.LoadInt32(&called); n != 2 {
+		t.Errorf(" = %v, want %v, should merge refreshes", n, 2)
+	}
+	if stats := fn.Pool.Stats(); stats.Merged != 9 {
+		t.Errorf(" = %v, want %v", stats.Merged, 9)
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err, "error closing cache")
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+)
+
+// privateKeySuffix separator of the user identity suffixed to cache key of private entries
+const privateKeySuffix = keySeparator + "user:"
+
+// Private per-user caching of requests with credentials,
+// cache key of private entries is suffixed by the user identity.
+// Purging a URL or prefix covers the private entries of all users,
+// mount NewAdmin of Cache to inspect the private entries kept apart
+type Private struct {
+	// User returns identity of the request user,
+	// requests of empty identity are not cached
+	User func(*http.Request) string
+
+	// Cache optional cache adapter of private entries,
+	// such as a Memory of its own size limit.
+	//
+	// by default private entries share Cache of HTTP
+	Cache Cache
+
+	// FreshFor fresh duration of private entries, defaults to FreshFor of HTTP
+	FreshFor time.Duration
+
+	// TTL time-to-live of private entries, defaults to TTL of HTTP
+	TTL time.Duration
+
+	// MaxBodySize maximum size of private response body to be cached,
+	// defaults to MaxBodySize of HTTP
+	MaxBodySize int64
+}
+
+// hasCredentials returns if request carries Authorization or Cookie header
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || len(r.Header.Values("Cookie")) > 0
+}
+
+// privateRequest returns HTTP of private entries and the cache key of request user,
+// or false if request should not be cached
+func (h HTTP) privateRequest(r *http.Request, key string) (HTTP, string, bool) {
+	if h.Private == nil || h.Private.User == nil {
+		return h, "", false
+	}
+	user := h.Private.User(r)
+	if user == "" {
+		return h, "", false
+	}
+	if h.Private.Cache != nil {
+		h.Cache = h.Private.Cache
+	}
+	if h.Private.FreshFor > 0 {
+		h.FreshFor = h.Private.FreshFor
+	}
+	if h.Private.TTL > 0 {
+		h.TTL = h.Private.TTL
+	}
+	if h.Private.MaxBodySize > 0 {
+		h.MaxBodySize = h.Private.MaxBodySize
+	}
+	h.private = true
+	return h, derivedKey(key, "user", user), true
+}
+
+// privateCache returns cache adapter of private entries, or nil if not cached
+func (h HTTP) privateCache() Cache {
+	if h.ShareCredentials || h.Private == nil || h.Private.User == nil {
+		return nil
+	}
+	if h.Private.Cache != nil {
+		return h.Private.Cache
+	}
+	return h.Cache
+}
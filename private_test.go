@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Private(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		w.Header().Set("Surrogate-Key", "a")
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	})
+	user := func(r *http.Request) string {
+		return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	private := NewMemory(10, int64(10<<20), -1)
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.HonorCacheControl = true
+	do := func(h *HTTP, header map[string]string) string {
+		r := httptest.NewRequest(http.MethodGet, "http://foo.bar/a", nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.Handler(handler).ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{"authorization", map[string]string{"Authorization": "Bearer u1"}, "1"},
+		{"authorization not cached", map[string]string{"Authorization": "Bearer u1"}, "2"},
+		{"cookie not cached", map[string]string{"Cookie": "session=s"}, "3"},
+		{"private not cached", nil, "4"},
+	}
+	for _, tt := range tests {
+		if got := do(h, tt.header); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	counter = 0
+	p := *h
+	p.Private = &Private{User: user, Cache: private, TTL: time.Minute}
+	tests = []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{"u1 miss", map[string]string{"Authorization": "Bearer u1"}, "1"},
+		{"u1 hit", map[string]string{"Authorization": "Bearer u1"}, "1"},
+		{"u2 miss", map[string]string{"Authorization": "Bearer u2"}, "2"},
+		{"u2 hit", map[string]string{"Authorization": "Bearer u2"}, "2"},
+		{"no identity", map[string]string{"Cookie": "session=s"}, "3"},
+		{"no identity again", map[string]string{"Cookie": "session=s"}, "4"},
+	}
+	for _, tt := range tests {
+		if got := do(&p, tt.header); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	keys, _ := private.Keys(context.Background(), "http://", 0)
+	if len(keys) != 2 || keys[0] != "http://foo.bar/a\x00user:u1" || keys[1] != "http://foo.bar/a\x00user:u2" {
+		t.Errorf("private keys = %v", keys)
+	}
+	if keys, _ := h.Cache.(*Memory).Keys(context.Background(), "", 0); len(keys) != 0 {
+		t.Errorf("shared keys = %v, private entries should not be shared", keys)
+	}
+
+	for name, purge := range map[string]func() error{
+		"PurgeURL":          func() error { return p.PurgeURL(context.Background(), "http://foo.bar/a") },
+		"PurgePrefix":       func() error { return p.PurgePrefix(context.Background(), "http://foo.bar/") },
+		"PurgeSurrogateKey": func() error { return p.PurgeSurrogateKey(context.Background(), "a") },
+	} {
+		do(&p, map[string]string{"Authorization": "Bearer u1"})
+		private.Cache.Wait()
+		if err := purge(); err != nil {
+			t.Error(name, err)
+		}
+		private.Cache.Wait()
+		if keys, _ := private.Keys(context.Background(), "http://foo.bar/a", 0); len(keys) != 0 {
+			t.Errorf("%s private keys = %v, should purge private entries", name, keys)
+		}
+	}
+
+	counter = 0
+	s := *h
+	s.ShareCredentials = true
+	handler = func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		_, _ = w.Write([]byte(strconv.Itoa(counter)))
+	}
+	if got := do(&s, map[string]string{"Cookie": "a=1"}); got != "1" {
+		t.Errorf("shared miss = %v, want %v", got, "1")
+	}
+	if got := do(&s, map[string]string{"Cookie": "a=2"}); got != "1" {
+		t.Errorf("shared hit = %v, want %v, credentials should share cache", got, "1")
+	}
+}
+
+func TestHTTP_Private_KeyCollision(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := r.Header.Get("Authorization"); user != "" {
+			_, _ = w.Write([]byte("secret of " + user))
+			return
+		}
+		_, _ = w.Write([]byte("public"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.Private = &Private{User: func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	}}
+	do := func(query, user string) string {
+		r := httptest.NewRequest(http.MethodGet, "http://foo.bar/a", nil)
+		// servers keep a raw # of request URI in the query
+		r.URL.RawQuery = query
+		if user != "" {
+			r.Header.Set("Authorization", user)
+		}
+		w := httptest.NewRecorder()
+		h.Handler(handler).ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	do("x=", "bob")
+	if got := do("x=#user:bob", ""); got != "public" {
+		t.Errorf(" = %v, want %v, private key should not collide with request key", got, "public")
+	}
+}
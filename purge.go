@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/ristretto/z"
+)
+
+// MethodPurge request method of cache purge
+const MethodPurge = "PURGE"
+
+const (
+	// surrogateIndexPrefix key prefix of index entries listing the keys of a surrogate key
+	surrogateIndexPrefix = "#surrogate-key:"
+
+	// variantIndexPrefix key prefix of index entries listing the variant keys of a key
+	variantIndexPrefix = "#variants:"
+
+	// maxIndexKeys maximum number of keys in an index entry, oldest keys dropped first
+	maxIndexKeys = 10000
+)
+
+// surrogateKeys returns the space separated labels of Surrogate-Key header
+func surrogateKeys(header http.Header) (keys []string) {
+	for _, value := range header.Values("Surrogate-Key") {
+		keys = append(keys, strings.Fields(value)...)
+	}
+	return
+}
+
+// indexed wraps fn to index key of the fetched payload under its surrogate keys,
+// and under variantIndex if key is a variant
+func (h HTTP) indexed(
+	key, variantIndex string,
+	fn func(context.Context) (*payload, error),
+) func(context.Context) (*payload, error) {
+	return func(ctx context.Context) (*payload, error) {
+		p, err := fn(ctx)
+		if err != nil || p == nil {
+			return p, err
+		}
+		var indexes []string
+		for _, label := range surrogateKeys(p.Header) {
+			indexes = append(indexes, h.cacheKey(surrogateIndexPrefix+label))
+		}
+		if variantIndex != "" {
+			indexes = append(indexes, variantIndex)
+		}
+		if len(indexes) > 0 {
+			ttl := h.TTL
+			if p.ttl > ttl {
+				ttl = p.ttl
+			}
+			ctx := DetachContext(ctx)
+			h.background().Go(func() {
+				for _, index := range indexes {
+					_ = addIndex(ctx, h.Cache, index, ttl, key)
+				}
+			})
+		}
+		return p, err
+	}
+}
+
+// indexLocks serializes in-process updates of index entries, striped by index hash
+var indexLocks [64]sync.Mutex
+
+func indexLock(index string) *sync.Mutex {
+	hash, _ := z.KeyToHash(index)
+	return &indexLocks[hash%uint64(len(indexLocks))]
+}
+
+// addIndex adds keys into index entry, extending its ttl if needed.
+// Update is atomic if cache implements IndexCache, otherwise under in-process lock of index
+func addIndex(ctx context.Context, c Cache, index string, ttl time.Duration, keys ...string) error {
+	if ic, ok := c.(IndexCache); ok {
+		return ic.AddIndex(ctx, index, ttl, keys...)
+	}
+	mu := indexLock(index)
+	mu.Lock()
+	defer mu.Unlock()
+	return mergeIndex(ctx, WithContext(c), index, ttl, keys...)
+}
+
+// mergeIndex fetches, merges keys into and sets index entry,
+// should be called under lock of index
+func mergeIndex(ctx context.Context, c ContextCache, index string, ttl time.Duration, keys ...string) error {
+	b, remain, err := c.FetchContext(ctx, index)
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	res := splitIndex(b)
+	if remain >= ttl && containsKeys(res, keys) {
+		return nil
+	}
+	for _, key := range keys {
+		res = append(removeKey(res, key), key)
+	}
+	if len(res) > maxIndexKeys {
+		res = res[len(res)-maxIndexKeys:]
+	}
+	if remain > ttl {
+		ttl = remain
+	}
+	return c.SetContext(ctx, index, []byte(strings.Join(res, "\n")), ttl)
+}
+
+// indexKeys returns keys listed by index entry
+func indexKeys(ctx context.Context, c Cache, index string) ([]string, error) {
+	if ic, ok := c.(IndexCache); ok {
+		return ic.IndexKeys(ctx, index)
+	}
+	return fetchIndex(ctx, WithContext(c), index)
+}
+
+func fetchIndex(ctx context.Context, c ContextCache, index string) ([]string, error) {
+	b, _, err := c.FetchContext(ctx, index)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return splitIndex(b), nil
+}
+
+// purgeIndex deletes index entry and the keys it lists
+func purgeIndex(ctx context.Context, c Cache, index string, keys ...string) error {
+	res, err := indexKeys(ctx, c, index)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, res...)
+	return WithContext(c).DelContext(ctx, append(keys, index)...)
+}
+
+func splitIndex(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(b), "\n")
+}
+
+func containsKeys(keys, subset []string) bool {
+	for _, key := range subset {
+		found := false
+		for _, k := range keys {
+			if k == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func removeKey(keys []string, key string) []string {
+	res := keys[:0]
+	for _, k := range keys {
+		if k != key {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// PurgeURL invalidates the cached response of URL, including its Vary variants.
+// The key is built by RequestKey from a GET request of URL, responses keyed otherwise,
+// such as POST requests keyed by body, are not covered and can be purged by PurgeKey or PurgePrefix
+func (h HTTP) PurgeURL(ctx context.Context, url string) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return h.PurgeKey(ctx, h.requestKey(r))
+}
+
+// PurgeKey invalidates the cached response of request key, including its Vary variants
+// and the private entries of all users
+func (h HTTP) PurgeKey(ctx context.Context, key string) error {
+	if err := purgeIndex(ctx, h.Cache, h.cacheKey(variantIndexPrefix+key), h.cacheKey(key)); err != nil {
+		return err
+	}
+	if c := h.privateCache(); c != nil {
+		// variants of private entries are keyed under the user suffix too
+		if err := delPrefix(ctx, c, h.cacheKey(key+privateKeySuffix)); err != nil {
+			return err
+		}
+		return delPrefix(ctx, c, h.cacheKey(variantIndexPrefix+key+privateKeySuffix))
+	}
+	return nil
+}
+
+// PurgePrefix invalidates the cached responses with keys of prefix, including private entries,
+// returns ErrNotSupported if the cache does not support deletion by prefix
+func (h HTTP) PurgePrefix(ctx context.Context, prefix string) error {
+	if err := delPrefix(ctx, h.Cache, h.cacheKey(prefix)); err != nil {
+		return err
+	}
+	if c := h.privateCache(); c != nil {
+		return delPrefix(ctx, c, h.cacheKey(prefix))
+	}
+	return nil
+}
+
+// PurgeSurrogateKey invalidates the cached responses labelled by
+// Surrogate-Key header of origin, including private entries
+func (h HTTP) PurgeSurrogateKey(ctx context.Context, label string) error {
+	index := h.cacheKey(surrogateIndexPrefix + label)
+	if err := purgeIndex(ctx, h.Cache, index); err != nil {
+		return err
+	}
+	if c := h.privateCache(); c != nil {
+		return purgeIndex(ctx, c, index)
+	}
+	return nil
+}
+
+// PurgeHandler returns admin http.Handler accepting PURGE requests,
+// that invalidates cached responses by url, key or prefix query parameter,
+// or by space separated labels of Surrogate-Key header
+func (h HTTP) PurgeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != MethodPurge {
+			w.Header().Set("Allow", MethodPurge)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		var (
+			ctx     = r.Context()
+			query   = r.URL.Query()
+			labels  = surrogateKeys(r.Header)
+			targets = 0
+			err     error
+		)
+		for _, url := range query["url"] {
+			targets++
+			if err == nil {
+				err = h.PurgeURL(ctx, url)
+			}
+		}
+		for _, key := range query["key"] {
+			targets++
+			if err == nil {
+				err = h.PurgeKey(ctx, key)
+			}
+		}
+		for _, prefix := range query["prefix"] {
+			targets++
+			if err == nil {
+				err = h.PurgePrefix(ctx, prefix)
+			}
+		}
+		for _, label := range labels {
+			targets++
+			if err == nil {
+				err = h.PurgeSurrogateKey(ctx, label)
+			}
+		}
+		switch {
+		case errors.Is(err, ErrNotSupported):
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": err.Error()})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		case targets == 0:
+			writeJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "url, key or prefix query parameter, or Surrogate-Key header required",
+			})
+		default:
+			writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
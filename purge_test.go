@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTP_PurgeHandler(t *testing.T) {
+	counter := map[string]int{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter[r.URL.Path]++
+		switch r.URL.Path {
+		case "/a":
+			w.Header().Set("Surrogate-Key", "article-1 all")
+		case "/b":
+			w.Header().Set("Surrogate-Key", "article-2  all")
+		case "/v":
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		_, _ = w.Write([]byte(strconv.Itoa(counter[r.URL.Path])))
+	})
+	h := NewHTTP(NewHybrid(
+		NewMemory(10, int64(10<<20), -1),
+		NewMemory(10, int64(10<<20), -1),
+	), time.Second, time.Minute, time.Hour)
+	cached := h.Handler(handler)
+	purge := h.PurgeHandler()
+	get := func(url, lang string) string {
+		r := httptest.NewRequest("GET", url, nil)
+		r.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	do := func(method, target string, header http.Header) int {
+		r := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		purge.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Code
+	}
+	fill := func() {
+		for _, url := range []string{"/a", "/b", "/c"} {
+			get(url, "")
+		}
+		get("/v", "en")
+		get("/v", "de")
+	}
+	fill()
+	fill()
+	if counter["/a"] != 1 || counter["/b"] != 1 || counter["/c"] != 1 || counter["/v"] != 2 {
+		t.Fatal(counter, "should be cached")
+	}
+
+	if code := do("GET", "/purge", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf(" = %v, want %v", code, http.StatusMethodNotAllowed)
+	}
+	if code := do(MethodPurge, "/purge", nil); code != http.StatusBadRequest {
+		t.Errorf(" = %v, want %v", code, http.StatusBadRequest)
+	}
+
+	if code := do(MethodPurge, "/purge", http.Header{"Surrogate-Key": {"article-1"}}); code != http.StatusOK {
+		t.Errorf(" = %v, want %v", code, http.StatusOK)
+	}
+	fill()
+	if counter["/a"] != 2 || counter["/b"] != 1 {
+		t.Error(counter, "should purge by surrogate key")
+	}
+
+	if code := do(MethodPurge, "/purge", http.Header{"Surrogate-Key": {"all"}}); code != http.StatusOK {
+		t.Errorf(" = %v, want %v", code, http.StatusOK)
+	}
+	fill()
+	if counter["/a"] != 3 || counter["/b"] != 2 || counter["/c"] != 1 {
+		t.Error(counter, "should purge all keys of surrogate key")
+	}
+
+	if code := do(MethodPurge, "/purge?url=/v", nil); code != http.StatusOK {
+		t.Errorf(" = %v, want %v", code, http.StatusOK)
+	}
+	fill()
+	if counter["/v"] != 4 || counter["/c"] != 1 {
+		t.Error(counter, "should purge url with its variants")
+	}
+
+	if code := do(MethodPurge, "/purge?prefix=/c", nil); code != http.StatusOK {
+		t.Errorf(" = %v, want %v", code, http.StatusOK)
+	}
+	fill()
+	if counter["/c"] != 2 {
+		t.Error(counter, "should purge by prefix")
+	}
+
+	if code := do(MethodPurge, "/purge?key=/b", nil); code != http.StatusOK {
+		t.Errorf(" = %v, want %v", code, http.StatusOK)
+	}
+	fill()
+	if counter["/b"] != 3 || counter["/a"] != 3 {
+		t.Error(counter, "should purge by key")
+	}
+
+	// Memory not created by NewMemory has no key index
+	u := *h
+	u.Cache = &Memory{Cache: NewMemory(10, int64(10<<20), -1).Cache}
+	purge = u.PurgeHandler()
+	if code := do(MethodPurge, "/purge?prefix=/c", nil); code != http.StatusNotImplemented {
+		t.Errorf(" = %v, want %v", code, http.StatusNotImplemented)
+	}
+}
+
+func TestAddIndex(t *testing.T) {
+	ctx := context.Background()
+	for name, c := range map[string]Cache{
+		"Memory": NewMemory(10, int64(10<<20), -1),
+		"Hybrid": NewHybrid(NewMemory(10, int64(10<<20), -1), NewMemory(10, int64(10<<20), -1)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if err := addIndex(ctx, c, "index", time.Minute, strconv.Itoa(i)); err != nil {
+						t.Error(err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			keys, err := indexKeys(ctx, c, "index")
+			if err != nil || len(keys) != 50 {
+				t.Errorf("indexKeys() = %v %v, should keep keys of concurrent adds", len(keys), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// withoutRange returns request without range headers,
+// so that the full response is fetched for cache
+func withoutRange(r *http.Request) *http.Request {
+	if r.Header.Get("Range") == "" && r.Header.Get("If-Range") == "" {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.Header.Del("Range")
+	r.Header.Del("If-Range")
+	return r
+}
+
+// serveRange serves Range and If-Range request from the cached full response,
+// as 206 Partial Content of single or multipart byte ranges
+func serveRange(w http.ResponseWriter, r *http.Request, p *payload) {
+	// lengths of the full response do not apply to the partial one,
+	// ServeContent leaves Content-Length as is for encoded content
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Range")
+	modified, _ := http.ParseTime(p.Header.Get("Last-Modified"))
+	http.ServeContent(w, r, "", modified, bytes.NewReader(p.Value))
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Range(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		if r.Header.Get("Range") != "" || r.Header.Get("If-Range") != "" {
+			t.Error("origin should not receive range headers")
+		}
+		if r.URL.Path == "/partial" {
+			w.Header().Set("Content-Range", "bytes 0-0/10")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte(strconv.Itoa(counter)))
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("0123456789"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	cached := h.Handler(handler)
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", url, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+	tests := []struct {
+		name         string
+		header       http.Header
+		wantCode     int
+		wantBody     string
+		contentRange string
+	}{
+		{"miss", http.Header{"Range": {"bytes=0-3"}}, http.StatusPartialContent, "0123", "bytes 0-3/10"},
+		{"hit", http.Header{"Range": {"bytes=-2"}}, http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"full", nil, http.StatusOK, "0123456789", ""},
+		{"if-range match", http.Header{"Range": {"bytes=2-"}, "If-Range": {`"v1"`}}, http.StatusPartialContent, "23456789", "bytes 2-9/10"},
+		{"if-range mismatch", http.Header{"Range": {"bytes=2-"}, "If-Range": {`"v0"`}}, http.StatusOK, "0123456789", ""},
+		{"unsatisfiable", http.Header{"Range": {"bytes=20-"}}, http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get("/a", tt.header)
+			if w.Code != tt.wantCode || (tt.wantBody != "" && w.Body.String() != tt.wantBody) {
+				t.Errorf(" = %v %v, want %v %v", w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			if got := w.Header().Get("Content-Range"); got != tt.contentRange {
+				t.Errorf("Content-Range = %v, want %v", got, tt.contentRange)
+			}
+		})
+	}
+	w := get("/a", http.Header{"Range": {"bytes=0-1,5-6"}})
+	if w.Code != http.StatusPartialContent ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "multipart/byteranges") {
+		t.Error(w.Code, w.Header(), "should serve multipart ranges")
+	}
+	if counter != 1 {
+		t.Errorf("counter = %v, want %v", counter, 1)
+	}
+	if get("/partial", nil).Body.String() != "2" || get("/partial", nil).Body.String() != "3" {
+		t.Error("partial response should not be cached")
+	}
+}
+
+func TestHTTP_Range_Encoded(t *testing.T) {
+	body, _ := EncodingGzip.Encode([]byte(strings.Repeat("0123456789", 100)))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write(body)
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	cached := h.Handler(handler)
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/a", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w
+	}
+	get(http.Header{"Accept-Encoding": {"gzip"}})
+	for _, ranges := range []string{"bytes=0-9", "bytes=0-1,3-4"} {
+		w := get(http.Header{"Accept-Encoding": {"gzip"}, "Range": {ranges}})
+		if w.Code != http.StatusPartialContent || w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatal(ranges, w.Code, w.Header(), "should serve range of encoded entry")
+		}
+		if got := w.Header().Get("Content-Length"); got != "" && got != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("%s Content-Length = %v, want %v", ranges, got, w.Body.Len())
+		}
+	}
+}
+
+func TestHTTP_RoundTrip_Range(t *testing.T) {
+	var counter int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&counter, 1)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("0123456789"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	rt := h.RoundTripper(roundTripper{Handler: handler})
+	for _, ranges := range []string{"bytes=0-1", ""} {
+		r := httptest.NewRequest("GET", "http://foo.bar/a", nil)
+		if ranges != "" {
+			r.Header.Set("Range", ranges)
+		}
+		res, err := rt.RoundTrip(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK || string(body) != "0123456789" {
+			t.Errorf("%q = %v %q, want full response", ranges, res.StatusCode, body)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := atomic.LoadInt32(&counter); n != 1 {
+		t.Errorf("counter = %v, want %v, full response of range request should be cached", n, 1)
+	}
+}
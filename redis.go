@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/vmihailenco/msgpack/v5"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,6 +23,10 @@ type Redis struct {
 	// LockPrefix prefix of lock key, default "!lock!"
 	LockPrefix string
 
+	// KeyFunc optional function transforms keys and lock keys,
+	// such as SafeKey for long keys or keys with glob metacharacters
+	KeyFunc KeyFunc
+
 	// DelayFunc is used to decide the amount of time to wait between lock retries.
 	DelayFunc func(tries int) time.Duration
 
@@ -52,10 +57,18 @@ func NewRedis(pool *redis.Pool) *Redis {
 }
 
 // Get implements the Get method
-func (c *Redis) Get(key string) (res []byte, err error) {
-	var conn = c.Pool.Get()
+func (c *Redis) Get(key string) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext implements the GetContext method
+func (c *Redis) GetContext(ctx context.Context, key string) (res []byte, err error) {
+	var conn redis.Conn
+	if conn, err = c.Pool.GetContext(ctx); err != nil {
+		return
+	}
 	defer conn.Close()
-	res, err = redis.Bytes(conn.Do("GET", c.Prefix+key))
+	res, err = redis.Bytes(redis.DoContext(conn, ctx, "GET", c.key(key)))
 	if err == redis.ErrNil {
 		err = ErrNotFound
 	}
@@ -63,26 +76,36 @@ func (c *Redis) Get(key string) (res []byte, err error) {
 }
 
 // Fetch get value and remaining ttl by key
-func (c *Redis) Fetch(key string) (value []byte, ttl time.Duration, err error) {
-	var conn = c.Pool.Get()
+func (c *Redis) Fetch(key string) ([]byte, time.Duration, error) {
+	return c.FetchContext(context.Background(), key)
+}
+
+// FetchContext implements the FetchContext method
+func (c *Redis) FetchContext(
+	ctx context.Context, key string,
+) (value []byte, ttl time.Duration, err error) {
+	var conn redis.Conn
+	if conn, err = c.Pool.GetContext(ctx); err != nil {
+		return
+	}
 	defer conn.Close()
-	if err = conn.Send("GET", c.Prefix+key); err != nil {
+	if err = conn.Send("GET", c.key(key)); err != nil {
 		return
 	}
-	if err = conn.Send("PTTL", c.Prefix+key); err != nil {
+	if err = conn.Send("PTTL", c.key(key)); err != nil {
 		return
 	}
 	if err = conn.Flush(); err != nil {
 		return
 	}
-	if value, err = redis.Bytes(conn.Receive()); err != nil {
+	if value, err = redis.Bytes(redis.ReceiveContext(conn, ctx)); err != nil {
 		if err == redis.ErrNil {
 			err = ErrNotFound
 		}
 		return
 	}
 	var pTTL int64
-	if pTTL, err = redis.Int64(conn.Receive()); err != nil {
+	if pTTL, err = redis.Int64(redis.ReceiveContext(conn, ctx)); err != nil {
 		return
 	}
 	ttl = fromMilliSec(pTTL)
@@ -91,9 +114,21 @@ func (c *Redis) Fetch(key string) (value []byte, ttl time.Duration, err error) {
 
 // Set implements the Set method
 func (c *Redis) Set(key string, value []byte, ttl time.Duration) error {
-	var conn = c.Pool.Get()
+	return c.SetContext(context.Background(), key, value, ttl)
+}
+
+// SetContext implements the SetContext method
+func (c *Redis) SetContext(
+	ctx context.Context, key string, value []byte, ttl time.Duration,
+) error {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	if _, err := conn.Do("PSETEX", c.Prefix+key, toMilliSec(ttl), value); err != nil {
+	if _, err := redis.DoContext(
+		conn, ctx, "PSETEX", c.key(key), toMilliSec(ttl), value,
+	); err != nil {
 		return err
 	}
 	return nil
@@ -101,14 +136,22 @@ func (c *Redis) Set(key string, value []byte, ttl time.Duration) error {
 
 // Del implements the Del method
 func (c *Redis) Del(keys ...string) error {
+	return c.DelContext(context.Background(), keys...)
+}
+
+// DelContext implements the DelContext method
+func (c *Redis) DelContext(ctx context.Context, keys ...string) error {
 	var keyArgs []interface{}
 	for _, key := range keys {
-		keyArgs = append(keyArgs, c.Prefix+key)
+		keyArgs = append(keyArgs, c.key(key))
 	}
 	if len(keyArgs) > 0 {
-		var conn = c.Pool.Get()
+		conn, err := c.Pool.GetContext(ctx)
+		if err != nil {
+			return err
+		}
 		defer conn.Close()
-		if _, err := conn.Do("DEL", keyArgs...); err != nil {
+		if _, err := redis.DoContext(conn, ctx, "DEL", keyArgs...); err != nil {
 			return err
 		}
 	}
@@ -121,7 +164,7 @@ func (c *Redis) Clear() (err error) {
 	ttl := time.Millisecond * 300
 	start := time.Now()
 	_, err = c.Race("!clear!", func() (b []byte, err error) {
-		err = c.delByPattern(c.Prefix+"*", 5000, timeout)
+		err = c.delByPattern(escapeGlob(c.Prefix)+"*", 5000, timeout)
 		return
 	}, timeout, ttl)
 	// make sure elapsed time > suppression ttl
@@ -131,6 +174,96 @@ func (c *Redis) Clear() (err error) {
 	return
 }
 
+// DelPrefix implements the PrefixCache interface by SCAN keys under prefix and batched DEL
+func (c *Redis) DelPrefix(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timeout := time.Minute * 10
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return c.delByPattern(escapeGlob(c.key(prefix))+"*", 5000, timeout)
+}
+
+// addIndexScript adds ARGV[2:] into set of KEYS[1],
+// extending its ttl to ARGV[1] milliseconds if needed
+var addIndexScript = redis.NewScript(1, `
+redis.call("SADD", KEYS[1], unpack(ARGV, 2))
+if redis.call("PTTL", KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// AddIndex implements the IndexCache interface by SADD into a redis set
+func (c *Redis) AddIndex(ctx context.Context, index string, ttl time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = addIndexScript.DoContext(
+		ctx, conn, redis.Args{}.Add(c.key(index), toMilliSec(ttl)).AddFlat(keys)...,
+	)
+	return err
+}
+
+// IndexKeys implements the IndexCache interface by SMEMBERS of the redis set
+func (c *Redis) IndexKeys(ctx context.Context, index string) ([]string, error) {
+	conn, err := c.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return redis.Strings(redis.DoContext(conn, ctx, "SMEMBERS", c.key(index)))
+}
+
+// Keys implements the KeysCache interface by SCAN keys under prefix.
+// Returns ErrNotSupported if KeyFunc is set, as the original keys cannot be recovered
+func (c *Redis) Keys(ctx context.Context, prefix string, limit int) (keys []string, err error) {
+	if c.KeyFunc != nil {
+		return nil, ErrNotSupported
+	}
+	var conn redis.Conn
+	if conn, err = c.Pool.GetContext(ctx); err != nil {
+		return
+	}
+	defer conn.Close()
+	var (
+		iter       = 0
+		pattern    = escapeGlob(c.key(prefix)) + "*"
+		lockPrefix = c.lockPrefix()
+	)
+	for {
+		var arr []interface{}
+		if arr, err = redis.Values(redis.DoContext(
+			conn, ctx, "SCAN", iter, "MATCH", pattern, "COUNT", 1000,
+		)); err != nil {
+			return
+		}
+		iter, _ = redis.Int(arr[0], nil)
+		var res, _ = redis.Strings(arr[1], nil)
+		for _, key := range res {
+			if strings.HasPrefix(key, lockPrefix) {
+				continue
+			}
+			keys = append(keys, strings.TrimPrefix(key, c.Prefix))
+		}
+		if iter == 0 || (limit > 0 && len(keys) >= limit) {
+			break
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return
+}
+
 // Close implements the Close method
 func (c *Redis) Close() error {
 	return c.Pool.Close()
@@ -139,26 +272,38 @@ func (c *Redis) Close() error {
 // Race implements the Race method using SEX NX
 func (c *Redis) Race(
 	key string, fn func() ([]byte, error), waitFor, ttl time.Duration,
+) ([]byte, error) {
+	return c.RaceContext(context.Background(), key, fn, waitFor, ttl)
+}
+
+// RaceContext implements the RaceContext method using SEX NX
+func (c *Redis) RaceContext(
+	ctx context.Context, key string, fn func() ([]byte, error), waitFor, ttl time.Duration,
 ) (value []byte, err error) {
 	if c.SkipLock {
 		return fn()
 	}
 	var (
-		retries     int
-		lockKey     = c.lockPrefix() + key
-		ctx, cancel = context.WithTimeout(context.Background(), waitFor)
+		retries int
+		lockKey = c.lockPrefix() + c.transformKey(key)
+		cancel  func()
 	)
+	ctx, cancel = context.WithTimeout(ctx, waitFor)
 	defer cancel()
 	for {
-		resp, locked, e := c.lock(lockKey, waitFor)
+		resp, locked, e := c.lock(ctx, lockKey, waitFor)
 		if e != nil {
+			if err = ctx.Err(); err != nil {
+				return
+			}
 			// if redis upstream failed, handle directly
 			// instead of crashing downstream consumers
 			return fn()
 		}
 		if locked {
 			value, err = fn()
-			if e := c.setRaceResp(lockKey, value, err, ttl); e != nil {
+			// response should be set even if waiting context is done
+			if e := c.setRaceResp(DetachContext(ctx), lockKey, value, err, ttl); e != nil {
 				err = e
 			}
 			return
@@ -175,9 +320,13 @@ func (c *Redis) Race(
 			// delay should be within ttl
 			delay = maxDelay
 		}
-		time.Sleep(delay)
-		if err = ctx.Err(); err != nil {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
 			return
+		case <-timer.C:
 		}
 	}
 }
@@ -220,9 +369,12 @@ func (c *Redis) delByPattern(pattern string, n int, timeout time.Duration) (err
 }
 
 func (c *Redis) lock(
-	key string, timeout time.Duration,
+	ctx context.Context, key string, timeout time.Duration,
 ) (value []byte, locked bool, err error) {
-	var conn = c.Pool.Get()
+	var conn redis.Conn
+	if conn, err = c.Pool.GetContext(ctx); err != nil {
+		return
+	}
 	defer conn.Close()
 	if err = conn.Send("SET", key, "1", "PX", toMilliSec(timeout), "NX"); err != nil {
 		return
@@ -233,16 +385,18 @@ func (c *Redis) lock(
 	if err = conn.Flush(); err != nil {
 		return
 	}
-	if ok, e := redis.String(conn.Receive()); ok == "OK" && e == nil {
+	if ok, e := redis.String(redis.ReceiveContext(conn, ctx)); ok == "OK" && e == nil {
 		locked = true
 	}
-	if value, err = redis.Bytes(conn.Receive()); err != nil {
+	if value, err = redis.Bytes(redis.ReceiveContext(conn, ctx)); err != nil {
 		return
 	}
 	return
 }
 
-func (c *Redis) setRaceResp(key string, value []byte, e error, ttl time.Duration) (err error) {
+func (c *Redis) setRaceResp(
+	ctx context.Context, key string, value []byte, e error, ttl time.Duration,
+) (err error) {
 	var (
 		p = &lockRes{Res: value, Err: e}
 		b []byte
@@ -250,9 +404,12 @@ func (c *Redis) setRaceResp(key string, value []byte, e error, ttl time.Duration
 	if b, err = msgpack.Marshal(p); err != nil {
 		return
 	}
-	var conn = c.Pool.Get()
+	var conn redis.Conn
+	if conn, err = c.Pool.GetContext(ctx); err != nil {
+		return
+	}
 	defer conn.Close()
-	if _, err = conn.Do("PSETEX", key, toMilliSec(ttl), b); err != nil {
+	if _, err = redis.DoContext(conn, ctx, "PSETEX", key, toMilliSec(ttl), b); err != nil {
 		return
 	}
 	return
@@ -269,6 +426,17 @@ func (c *Redis) parseRaceResp(resp []byte) (ok bool, value []byte, err error) {
 	return
 }
 
+func (c *Redis) key(key string) string {
+	return c.Prefix + c.transformKey(key)
+}
+
+func (c *Redis) transformKey(key string) string {
+	if c.KeyFunc != nil {
+		return c.KeyFunc(key)
+	}
+	return key
+}
+
 func (c *Redis) lockPrefix() string {
 	if c.LockPrefix != "" {
 		return c.LockPrefix
@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Duration time.Duration of route documents, in JSON a duration string such as "1m30s"
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("hybridcache: duration should be a string: %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Route caching policy applied to requests matching its conditions,
+// options left zero fall back to the HTTP of Router
+type Route struct {
+	// Methods request methods matched among GET, HEAD and POST, defaults to GET and HEAD.
+	// POST requests are keyed by body hash as with AcceptPost
+	Methods []string `json:"methods,omitempty"`
+
+	// Host pattern of request host without port, in path.Match syntax
+	Host string `json:"host,omitempty"`
+
+	// Path pattern of request URL path, in path.Match syntax
+	Path string `json:"path,omitempty"`
+
+	// PathPrefix prefix of request URL path
+	PathPrefix string `json:"path_prefix,omitempty"`
+
+	// Headers patterns of request header values, in path.Match syntax,
+	// an empty pattern matches header absent
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Bypass passes matching requests through without caching
+	Bypass bool `json:"bypass,omitempty"`
+
+	// WaitFor request timeout
+	WaitFor Duration `json:"wait_for,omitempty"`
+
+	// FreshFor fresh duration until next refresh
+	FreshFor Duration `json:"fresh_for,omitempty"`
+
+	// TTL cache time-to-live
+	TTL Duration `json:"ttl,omitempty"`
+
+	// StatusCodes response status codes to be cached,
+	// defaults to AcceptResponse of HTTP
+	StatusCodes []int `json:"status_codes,omitempty"`
+
+	// IgnoreQuery drops the query string from cache key
+	IgnoreQuery bool `json:"ignore_query,omitempty"`
+
+	// Query query parameters kept in cache key, the others dropped.
+	// Setting Query or IgnoreQuery sorts the query parameters of cache key
+	Query []string `json:"query,omitempty"`
+
+	// KeyHeaders request headers appended to cache key
+	KeyHeaders []string `json:"key_headers,omitempty"`
+}
+
+// ParseRoutes parses and validates a JSON array of routes.
+// YAML is not parsed, to keep the package free of a YAML dependency,
+// YAML documents of the same field names can be converted to JSON beforehand
+func ParseRoutes(b []byte) ([]Route, error) {
+	var routes []Route
+	if err := json.Unmarshal(b, &routes); err != nil {
+		return nil, err
+	}
+	for i, route := range routes {
+		if err := route.Validate(); err != nil {
+			return nil, fmt.Errorf("hybridcache: route %d: %w", i, err)
+		}
+	}
+	return routes, nil
+}
+
+// Validate returns error if route patterns are malformed,
+// or methods other than GET, HEAD and POST are matched
+func (route Route) Validate() error {
+	for _, method := range route.Methods {
+		if !hasMethod([]string{http.MethodGet, http.MethodHead, http.MethodPost}, method) {
+			return fmt.Errorf("method not cacheable: %q", method)
+		}
+	}
+	patterns := []string{route.Host, route.Path}
+	for _, pattern := range route.Headers {
+		patterns = append(patterns, pattern)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: %q", err, pattern)
+		}
+	}
+	if route.WaitFor < 0 || route.FreshFor < 0 || route.TTL < 0 {
+		return errors.New("negative duration")
+	}
+	return nil
+}
+
+// Match returns if request matches conditions of route
+func (route Route) Match(r *http.Request) bool {
+	if len(route.Methods) == 0 {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return false
+		}
+	} else if !hasMethod(route.Methods, r.Method) {
+		return false
+	}
+	if route.Host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if ok, _ := path.Match(route.Host, strings.ToLower(host)); !ok {
+			return false
+		}
+	}
+	if route.Path != "" {
+		if ok, _ := path.Match(route.Path, r.URL.Path); !ok {
+			return false
+		}
+	}
+	if !strings.HasPrefix(r.URL.Path, route.PathPrefix) {
+		return false
+	}
+	for name, pattern := range route.Headers {
+		if ok, _ := path.Match(pattern, r.Header.Get(name)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns HTTP with options of route
+func (route Route) apply(h HTTP) *HTTP {
+	if route.WaitFor > 0 {
+		h.WaitFor = time.Duration(route.WaitFor)
+	}
+	if route.FreshFor > 0 {
+		h.FreshFor = time.Duration(route.FreshFor)
+	}
+	if route.TTL > 0 {
+		h.TTL = time.Duration(route.TTL)
+	}
+	// the route accepts the requests it matches, subject to the filters of HTTP if any
+	accept, acceptPost := h.AcceptRequest, h.AcceptPost
+	h.AcceptRequest = func(r *http.Request) bool {
+		return route.Match(r) && (accept == nil || accept(r))
+	}
+	h.AcceptPost = func(r *http.Request) bool {
+		return route.Match(r) && (acceptPost == nil || acceptPost(r))
+	}
+	if len(route.StatusCodes) > 0 {
+		codes := route.StatusCodes
+		h.AcceptResponse = func(res *http.Response) bool {
+			for _, code := range codes {
+				if res.StatusCode == code {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	if route.IgnoreQuery || len(route.Query) > 0 || len(route.KeyHeaders) > 0 {
+		requestKey := h.RequestKey
+		h.RequestKey = func(r *http.Request) string {
+			return route.requestKey(r, requestKey)
+		}
+	}
+	return &h
+}
+
+// requestKey returns cache key of request normalized by route
+func (route Route) requestKey(r *http.Request, requestKey func(*http.Request) string) string {
+	if route.IgnoreQuery || len(route.Query) > 0 {
+		u := *r.URL
+		if route.IgnoreQuery {
+			u.RawQuery = ""
+		} else {
+			query := url.Values{}
+			for k, v := range u.Query() {
+				for _, name := range route.Query {
+					if k == name {
+						query[k] = v
+					}
+				}
+			}
+			// Encode sorts by key
+			u.RawQuery = query.Encode()
+		}
+		rr := new(http.Request)
+		*rr = *r
+		rr.URL = &u
+		r = rr
+	}
+	var key string
+	if requestKey != nil {
+		key = requestKey(r)
+	} else {
+		key = r.URL.String()
+	}
+	if len(route.KeyHeaders) > 0 {
+		names := append([]string(nil), route.KeyHeaders...)
+		sort.Strings(names)
+		var b strings.Builder
+		for _, name := range names {
+			b.WriteString(headerKey(r.Header, name))
+		}
+		key += b.String()
+	}
+	return key
+}
+
+func hasMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Router HTTP cache middleware applying the policy of the first route matching a request.
+// Requests matching no route are handled by HTTP as is
+type Router struct {
+	// HTTP base cache middleware, routes override its options
+	HTTP *HTTP
+
+	// Routes matched in order
+	Routes []Route
+}
+
+// NewRouter creates cache policy router of HTTP middleware and routes
+func NewRouter(h *HTTP, routes ...Route) *Router {
+	return &Router{
+		HTTP:   h,
+		Routes: routes,
+	}
+}
+
+// route returns HTTP of the route matching request, or nil if request bypasses the cache
+func (rt *Router) route(r *http.Request) *HTTP {
+	for _, route := range rt.Routes {
+		if route.Match(r) {
+			if route.Bypass {
+				return nil
+			}
+			return route.apply(*rt.HTTP)
+		}
+	}
+	return rt.HTTP
+}
+
+// Handler is the HTTP cache middleware handler with routes
+func (rt *Router) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := rt.route(r); h != nil {
+			h.Handler(next).ServeHTTP(w, r)
+		} else {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// RoundTripper wraps and returns a http.RoundTripper for cache with routes
+func (rt *Router) RoundTripper(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return routerTransport{rt, transport}
+}
+
+type routerTransport struct {
+	*Router
+	transport http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t routerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if h := t.route(r); h != nil {
+		return h.RoundTripper(t.transport).RoundTrip(r)
+	}
+	return t.transport.RoundTrip(r)
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes([]byte(`[
+		{"path": "/admin/*", "bypass": true},
+		{"methods": ["GET", "POST"], "host": "*.foo.bar", "path_prefix": "/api/",
+			"headers": {"X-Tenant": "?*"}, "ttl": "1h30m", "fresh_for": "10s",
+			"query": ["page"], "key_headers": ["x-tenant"], "status_codes": [200]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || !routes[0].Bypass || time.Duration(routes[1].TTL) != time.Hour+time.Minute*30 ||
+		time.Duration(routes[1].FreshFor) != time.Second*10 || routes[1].Headers["X-Tenant"] != "?*" {
+		t.Errorf("routes = %+v", routes)
+	}
+	for _, doc := range []string{
+		`[{"path": "/a/["}]`,
+		`[{"headers": {"X-Foo": "[" }}]`,
+		`[{"ttl": "1 hour"}]`,
+		`[{"ttl": 10}]`,
+		`[{"ttl": "-1s"}]`,
+		`[{"methods": ["GET", "PUT"]}]`,
+		`[{"methods": ["delete"]}]`,
+	} {
+		if _, err := ParseRoutes([]byte(doc)); err == nil {
+			t.Errorf("%s should be invalid", doc)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var counter int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&counter, 1)
+		_, _ = w.Write([]byte(strconv.Itoa(int(n))))
+	})
+	routes, err := ParseRoutes([]byte(`[
+		{"path": "/admin/*", "bypass": true},
+		{"host": "*.foo.bar", "path_prefix": "/api/", "headers": {"X-Tenant": "?*"},
+			"query": ["page"], "key_headers": ["X-Tenant"]},
+		{"methods": ["POST"], "path": "/graphql"},
+		{"path": "/short", "fresh_for": "10ms"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	rt := NewRouter(h, routes...)
+	c := *h
+	c.Cache = NewMemory(10, int64(10<<20), -1)
+	crt := NewRouter(&c, routes...)
+	handlers := map[string]http.Handler{
+		"Handler":      rt.Handler(handler),
+		"RoundTripper": roundTripHandler{crt.RoundTripper(roundTripper{Handler: handler})},
+	}
+	for name, cached := range handlers {
+		atomic.StoreInt32(&counter, 0)
+		t.Run(name, func(t *testing.T) {
+			do := func(method, url, tenant, body string) string {
+				r := httptest.NewRequest(method, url, strings.NewReader(body))
+				if tenant != "" {
+					r.Header.Set("X-Tenant", tenant)
+				}
+				w := httptest.NewRecorder()
+				cached.ServeHTTP(w, r)
+				time.Sleep(time.Millisecond * 20)
+				return w.Body.String()
+			}
+			tests := []struct {
+				name   string
+				method string
+				url    string
+				tenant string
+				body   string
+				want   string
+			}{
+				{"default miss", "GET", "http://foo.bar/a", "", "", "1"},
+				{"default hit", "GET", "http://foo.bar/a", "", "", "1"},
+				{"bypass", "GET", "http://foo.bar/admin/a", "", "", "2"},
+				{"bypass again", "GET", "http://foo.bar/admin/a", "", "", "3"},
+				{"api miss", "GET", "http://x.foo.bar/api/a?page=1&utm=a", "t1", "", "4"},
+				{"api normalized query", "GET", "http://x.foo.bar/api/a?utm=b&page=1", "t1", "", "4"},
+				{"api other tenant", "GET", "http://x.foo.bar/api/a?page=1", "t2", "", "5"},
+				{"api no tenant", "GET", "http://x.foo.bar/api/a?page=2", "", "", "6"},
+				{"api no tenant default key", "GET", "http://x.foo.bar/api/a?page=2", "", "", "6"},
+				{"post miss", "POST", "http://foo.bar/graphql", "", "q1", "7"},
+				{"post hit", "POST", "http://foo.bar/graphql", "", "q1", "7"},
+				{"post other body", "POST", "http://foo.bar/graphql", "", "q2", "8"},
+				{"post not routed", "POST", "http://foo.bar/a", "", "q1", "9"},
+				{"short miss", "GET", "http://foo.bar/short", "", "", "10"},
+				{"short stale", "GET", "http://foo.bar/short", "", "", "10"},
+				{"short refreshed", "GET", "http://foo.bar/short", "", "", "11"},
+			}
+			for _, tt := range tests {
+				if got := do(tt.method, tt.url, tt.tenant, tt.body); got != tt.want {
+					t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouter_AcceptFilters(t *testing.T) {
+	var counter int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&counter, 1)
+		_, _ = w.Write([]byte(strconv.Itoa(int(n))))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	h.AcceptRequest = func(r *http.Request) bool {
+		return r.Method == http.MethodGet && !strings.Contains(r.URL.RawQuery, "nocache")
+	}
+	h.AcceptPost = func(r *http.Request) bool {
+		return r.Header.Get("X-No-Cache") == ""
+	}
+	cached := NewRouter(h, Route{Methods: []string{"GET", "POST"}, PathPrefix: "/api/"}).Handler(handler)
+	do := func(method, url string, noCache bool) string {
+		r := httptest.NewRequest(method, url, strings.NewReader("q"))
+		if noCache {
+			r.Header.Set("X-No-Cache", "1")
+		}
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		noCache bool
+		want    string
+	}{
+		{"get miss", "GET", "http://foo.bar/api/a", false, "1"},
+		{"get hit", "GET", "http://foo.bar/api/a", false, "1"},
+		{"get nocache", "GET", "http://foo.bar/api/a?nocache", false, "2"},
+		{"get nocache again", "GET", "http://foo.bar/api/a?nocache", false, "3"},
+		{"post miss", "POST", "http://foo.bar/api/a", false, "4"},
+		{"post hit", "POST", "http://foo.bar/api/a", false, "4"},
+		{"post no cache", "POST", "http://foo.bar/api/b", true, "5"},
+		{"post no cache again", "POST", "http://foo.bar/api/b", true, "6"},
+	}
+	for _, tt := range tests {
+		if got := do(tt.method, tt.url, tt.noCache); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
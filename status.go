@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheStatus records how a response is served from cache
+type cacheStatus struct {
+	key     string
+	served  bool
+	stale   bool
+	refresh bool
+	errored bool
+	fwd     string
+}
+
+// hit records response served from cache
+func (s *cacheStatus) hit(key string, stale, refresh bool) {
+	if s == nil {
+		return
+	}
+	*s = cacheStatus{key: key, served: true, stale: stale, refresh: refresh}
+}
+
+// forward records response forwarded to origin with reason fwd
+func (s *cacheStatus) forward(key, fwd string) {
+	if s == nil {
+		return
+	}
+	*s = cacheStatus{key: key, fwd: fwd}
+}
+
+// staleOnError records stale response served as fetching failed
+func (s *cacheStatus) staleOnError(key string) {
+	if s == nil {
+		return
+	}
+	*s = cacheStatus{key: key, served: true, stale: true, errored: true}
+}
+
+// xCache returns X-Cache header value
+func (s *cacheStatus) xCache() string {
+	switch {
+	case !s.served:
+		return "MISS"
+	case s.stale:
+		return "STALE"
+	}
+	return "HIT"
+}
+
+// setStatusHeaders sets Age, X-Cache and Cache-Status headers of response
+func (h HTTP) setStatusHeaders(header http.Header, p *payload, s *cacheStatus) {
+	if s == nil {
+		return
+	}
+	now := time.Now()
+	age, _ := strconv.ParseInt(p.Header.Get("Age"), 10, 64)
+	if age < 0 {
+		age = 0
+	}
+	if !p.Created.IsZero() && now.After(p.Created) {
+		age += int64(now.Sub(p.Created) / time.Second)
+	}
+	header.Set("Age", strconv.FormatInt(age, 10))
+	header.Set("X-Cache", s.xCache())
+
+	name := h.CacheName
+	if name == "" {
+		name = "hybridcache"
+	}
+	params := []string{name}
+	if s.served {
+		params = append(params, "hit")
+	} else {
+		params = append(params, "fwd="+s.fwd, "fwd-status="+strconv.Itoa(p.StatusCode))
+	}
+	ttl := p.BestBefore.Sub(now) / time.Second
+	params = append(params, "ttl="+strconv.FormatInt(int64(ttl), 10))
+	if s.key != "" {
+		params = append(params, "key="+quoteString(s.key))
+	}
+	if s.refresh {
+		params = append(params, "detail=refresh")
+	}
+	if s.errored {
+		params = append(params, "detail=stale-on-error")
+	}
+	header.Set("Cache-Status", strings.Join(params, "; "))
+}
+
+// quoteString returns structured field string of s
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7e:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
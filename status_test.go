@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP_StatusHeaders(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/age" {
+			w.Header().Set("Age", "100")
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Millisecond*100, time.Hour)
+	h.StatusHeaders = true
+	c := *h
+	c.Cache = NewMemory(10, int64(10<<20), -1)
+	handlers := map[string]http.Handler{
+		"Handler":      h.Handler(handler),
+		"RoundTripper": roundTripHandler{c.RoundTripper(roundTripper{Handler: handler})},
+	}
+	for name, cached := range handlers {
+		t.Run(name, func(t *testing.T) {
+			get := func(url string) http.Header {
+				w := httptest.NewRecorder()
+				cached.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+				time.Sleep(time.Millisecond * 10)
+				return w.Header()
+			}
+			tests := []struct {
+				url         string
+				sleep       time.Duration
+				age         string
+				xCache      string
+				cacheStatus string
+			}{
+				{"/a", 0, "0", "MISS", `hybridcache; fwd=uri-miss; fwd-status=200; ttl=0; key="/a"`},
+				{"/a", 0, "0", "HIT", `hybridcache; hit; ttl=0; key="/a"`},
+				{"/a", time.Millisecond * 100, "0", "STALE", `hybridcache; hit; ttl=0; key="/a"; detail=refresh`},
+				{"/a\"", 0, "0", "MISS", `hybridcache; fwd=uri-miss; fwd-status=200; ttl=0; key="/a%22"`},
+				{"/age", 0, "100", "MISS", `hybridcache; fwd=uri-miss; fwd-status=200; ttl=0; key="/age"`},
+			}
+			for _, tt := range tests {
+				time.Sleep(tt.sleep)
+				header := get(tt.url)
+				if header.Get("Age") != tt.age {
+					t.Errorf("%v Age = %v, want %v", tt.url, header.Get("Age"), tt.age)
+				}
+				if header.Get("X-Cache") != tt.xCache {
+					t.Errorf("%v X-Cache = %v, want %v", tt.url, header.Get("X-Cache"), tt.xCache)
+				}
+				if header.Get("Cache-Status") != tt.cacheStatus {
+					t.Errorf("%v Cache-Status = %v, want %v", tt.url, header.Get("Cache-Status"), tt.cacheStatus)
+				}
+			}
+		})
+	}
+}
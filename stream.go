@@ -0,0 +1,338 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errBypass response should bypass the cache
+var errBypass = errors.New("hybridcache: bypass cache")
+
+// streamingContentTypes media types of long-lived responses that are never cached
+var streamingContentTypes = []string{
+	"text/event-stream", "multipart/x-mixed-replace", "application/grpc",
+}
+
+// liveWriter guards the client ResponseWriter streamed by the request fetching the response,
+// writes are discarded once the handler returns
+type liveWriter struct {
+	w        http.ResponseWriter
+	onHeader func(header http.Header, code int)
+	mu       sync.Mutex
+	written  bool
+	closed   bool
+	finished chan struct{}
+	once     sync.Once
+}
+
+func newLiveWriter(w http.ResponseWriter) *liveWriter {
+	return &liveWriter{w: w, finished: make(chan struct{})}
+}
+
+func (l *liveWriter) writeHeader(header http.Header, code int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed || l.written {
+		return
+	}
+	// consistent with responses served from cache
+	copyHeader(l.w.Header(), storedHeader(header))
+	if l.onHeader != nil {
+		l.onHeader(l.w.Header(), code)
+	}
+	l.w.WriteHeader(code)
+	l.written = true
+}
+
+func (l *liveWriter) write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return len(b), nil
+	}
+	return l.w.Write(b)
+}
+
+func (l *liveWriter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if f, ok := l.w.(http.Flusher); ok && !l.closed {
+		f.Flush()
+	}
+}
+
+func (l *liveWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	hj, ok := l.w.(http.Hijacker)
+	if !ok || l.closed {
+		return nil, nil, http.ErrNotSupported
+	}
+	l.written = true
+	return hj.Hijack()
+}
+
+// isWritten returns if response has been written to client
+func (l *liveWriter) isWritten() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.written
+}
+
+// finish marks the response streamed to client complete
+func (l *liveWriter) finish() {
+	l.once.Do(func() {
+		close(l.finished)
+	})
+}
+
+// close detaches the client ResponseWriter,
+// returns if response has been written to client,
+// in which case it waits until the response is completely streamed
+func (l *liveWriter) close() bool {
+	l.mu.Lock()
+	written := l.written
+	l.closed = !written
+	l.mu.Unlock()
+	if !written {
+		return false
+	}
+	<-l.finished
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	return true
+}
+
+// teeWriter records response of the next handler up to limit bytes of body,
+// while streaming to the live client if attached
+type teeWriter struct {
+	live        *liveWriter
+	stream      func(code int) bool
+	header      http.Header
+	code        int
+	body        bytes.Buffer
+	limit       int64
+	wroteHeader bool
+	bypass      bool
+
+	// discard drops the body once bypassed, as no client is waiting for it
+	discard bool
+
+	// onBypass called when response streamed to live client bypasses the cache
+	onBypass func()
+}
+
+func newTeeWriter(limit int64) *teeWriter {
+	return &teeWriter{header: http.Header{}, code: http.StatusOK, limit: limit}
+}
+
+func (t *teeWriter) Header() http.Header {
+	return t.header
+}
+
+func (t *teeWriter) WriteHeader(code int) {
+	if t.wroteHeader {
+		return
+	}
+	t.wroteHeader = true
+	t.code = code
+	if t.live != nil && (t.stream == nil || t.stream(code)) {
+		t.live.writeHeader(t.header, code)
+	} else {
+		t.live = nil
+	}
+	if isStreamingContentType(t.header.Get("Content-Type")) {
+		t.setBypass()
+	}
+}
+
+func (t *teeWriter) Write(b []byte) (int, error) {
+	if !t.wroteHeader {
+		if t.header.Get("Content-Type") == "" && t.header.Get("Transfer-Encoding") == "" {
+			t.header.Set("Content-Type", http.DetectContentType(b))
+		}
+		t.WriteHeader(http.StatusOK)
+	}
+	if !t.bypass && t.limit > 0 && int64(t.body.Len()+len(b)) > t.limit {
+		// over limit, pass through without caching
+		t.setBypass()
+	}
+	if t.bypass && (t.live != nil || t.discard) {
+		// streamed to client or not needed by anyone, no need to record
+		t.body = bytes.Buffer{}
+	} else {
+		t.body.Write(b)
+	}
+	if t.live != nil {
+		return t.live.write(b)
+	}
+	return len(b), nil
+}
+
+// Flush implements http.Flusher
+func (t *teeWriter) Flush() {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.live != nil {
+		t.live.flush()
+	}
+}
+
+// Hijack implements http.Hijacker, hijacked response bypasses the cache
+func (t *teeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if t.live == nil {
+		return nil, nil, http.ErrNotSupported
+	}
+	t.setBypass()
+	return t.live.hijack()
+}
+
+// setBypass marks response bypassing the cache
+func (t *teeWriter) setBypass() {
+	if t.bypass {
+		return
+	}
+	t.bypass = true
+	if t.live != nil && t.onBypass != nil {
+		t.onBypass()
+	}
+}
+
+// serve runs next handler recording into the tee, returns once the handler completes,
+// or errBypass as soon as the response streamed to live client bypasses the cache,
+// leaving the handler streaming until it completes.
+// With live client attached, the handler request is cancelled with the fetch context of r
+// until the response is written to client, then only with the client context
+func (t *teeWriter) serve(client context.Context, next http.Handler, r *http.Request) error {
+	var (
+		live     = t.live
+		done     = make(chan error, 1)
+		bypassed = make(chan struct{})
+		once     sync.Once
+	)
+	if live != nil {
+		var (
+			fetch       = r.Context()
+			ctx, cancel = context.WithCancel(client)
+		)
+		go func() {
+			select {
+			case <-fetch.Done():
+				if !live.isWritten() {
+					cancel()
+				}
+			case <-live.finished:
+			}
+			<-live.finished
+			cancel()
+		}()
+		r = r.WithContext(ctx)
+	}
+	t.onBypass = func() {
+		once.Do(func() {
+			close(bypassed)
+		})
+	}
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+			if live != nil {
+				live.finish()
+			}
+			done <- err
+		}()
+		next.ServeHTTP(t, r)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-bypassed:
+		return errBypass
+	}
+}
+
+// result returns the recorded response
+func (t *teeWriter) result() *http.Response {
+	res := &http.Response{
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		StatusCode:    t.code,
+		Status:        strconv.Itoa(t.code) + " " + http.StatusText(t.code),
+		Header:        t.header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(t.body.Bytes())),
+		ContentLength: -1,
+	}
+	if n, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64); err == nil {
+		res.ContentLength = n
+	}
+	return res
+}
+
+// headerPayload returns payload of response header without body,
+// for the cache status of response being streamed
+func (h HTTP) headerPayload(header http.Header, code int) *payload {
+	p := newPayload(nil)
+	p.Header, p.StatusCode = header, code
+	p.FreshFor(h.FreshFor)
+	if h.HonorCacheControl {
+		_ = h.applyCacheControl(p, header)
+	}
+	return p
+}
+
+// isStreamingContentType returns if content type is a long-lived streaming response
+func isStreamingContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range streamingContentTypes {
+		if mediaType == t || strings.HasPrefix(mediaType, t+"+") {
+			return true
+		}
+	}
+	return false
+}
+
+// isUpgrade returns if request asks for a connection upgrade, such as WebSocket
+func isUpgrade(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	return hasToken(r.Header.Values("Connection"), "upgrade")
+}
+
+// isStreamingRequest returns if request expects a long-lived response that bypasses the cache,
+// such as connection upgrade, event stream or gRPC
+func isStreamingRequest(r *http.Request) bool {
+	if isUpgrade(r) || isStreamingContentType(r.Header.Get("Content-Type")) {
+		return true
+	}
+	for _, value := range r.Header.Values("Accept") {
+		for _, item := range strings.Split(value, ",") {
+			if isStreamingContentType(strings.TrimSpace(item)) {
+				return true
+			}
+		}
+	}
+	return false
+}
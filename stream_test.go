@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Stream(t *testing.T) {
+	var (
+		counter int32
+		release = make(chan struct{})
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&counter, 1)
+		switch r.URL.Path {
+		case "/stream":
+			_, _ = w.Write([]byte("a"))
+			w.(http.Flusher).Flush()
+			<-release
+			_, _ = w.Write([]byte("b"))
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("x", 20) + strconv.Itoa(int(n))))
+		case "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: " + strconv.Itoa(int(n)) + "\n\n"))
+		case "/hijack":
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 1\r\nConnection: close\r\n\r\n" + strconv.Itoa(int(n)))
+			_ = buf.Flush()
+		default:
+			_, _ = w.Write([]byte(strconv.Itoa(int(n))))
+		}
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second*5, time.Minute, time.Hour)
+	h.MaxBodySize = 20
+	server := httptest.NewServer(h.Handler(handler))
+	defer server.Close()
+	get := func(path string, header http.Header) string {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		time.Sleep(time.Millisecond * 10)
+		return string(body)
+	}
+
+	res, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(res.Body)
+	if b, err := reader.ReadByte(); err != nil || b != 'a' {
+		t.Error(b, err, "should stream before handler completes")
+	}
+	close(release)
+	if rest, _ := io.ReadAll(reader); string(rest) != "b" {
+		t.Errorf(" = %v, want %v", string(rest), "b")
+	}
+	_ = res.Body.Close()
+	time.Sleep(time.Millisecond * 10)
+	if body := get("/stream", nil); body != "ab" {
+		t.Errorf(" = %v, want %v, should be cached", body, "ab")
+	}
+
+	atomic.StoreInt32(&counter, 0)
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   string
+	}{
+		{"cached", "/a", nil, "1"},
+		{"cached hit", "/a", nil, "1"},
+		{"over limit", "/large", nil, strings.Repeat("x", 20) + "2"},
+		{"over limit not cached", "/large", nil, strings.Repeat("x", 20) + "3"},
+		{"streaming content type", "/sse", nil, "data: 4\n\n"},
+		{"streaming content type not cached", "/sse", nil, "data: 5\n\n"},
+		{"upgrade", "/a", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"foo"}}, "6"},
+		{"hijack", "/hijack", nil, "7"},
+		{"hijack not cached", "/hijack", nil, "8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if body := get(tt.path, tt.header); body != tt.want {
+				t.Errorf(" = %v, want %v", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTP_Stream_Bypass(t *testing.T) {
+	var counter int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&counter, 1)
+		switch r.URL.Path {
+		case "/sse":
+			// long-lived stream outlasting WaitFor
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				_, _ = w.Write([]byte("data: " + strconv.Itoa(i) + "\n\n"))
+				w.(http.Flusher).Flush()
+				time.Sleep(time.Millisecond * 40)
+			}
+		default:
+			_, _ = w.Write([]byte(strings.Repeat("x", 20) + strconv.Itoa(int(n))))
+		}
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Millisecond*50, time.Minute, time.Hour)
+	h.MaxBodySize = 10
+	h.Conditional = true
+	server := httptest.NewServer(h.Handler(handler))
+	defer server.Close()
+	get := func(method, path string, header http.Header) (int, string) {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body)
+	}
+	events := "data: 0\n\ndata: 1\n\ndata: 2\n\n"
+
+	for _, header := range []http.Header{{"Accept": {"text/event-stream"}}, nil} {
+		atomic.StoreInt32(&counter, 0)
+		var (
+			wg     sync.WaitGroup
+			bodies = make([]string, 3)
+		)
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, bodies[i] = get("GET", "/sse", header)
+			}(i)
+		}
+		wg.Wait()
+		for _, body := range bodies {
+			if body != events {
+				t.Errorf("Accept %q = %q, want %q, stream should not be cut or merged", header.Get("Accept"), body, events)
+			}
+		}
+		if n := atomic.LoadInt32(&counter); n != 3 {
+			t.Errorf("counter = %v, want %v, each stream should reach origin once", n, 3)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+	}{
+		{"over limit", "GET", nil},
+		{"over limit range", "GET", http.Header{"Range": {"bytes=0-1"}}},
+		{"over limit conditional", "GET", http.Header{"If-None-Match": {`"foo"`}}},
+		{"over limit head", "HEAD", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&counter, 0)
+			code, _ := get(tt.method, "/large", tt.header)
+			if code >= 400 {
+				t.Errorf("code = %v", code)
+			}
+			time.Sleep(time.Millisecond * 10)
+			if n := atomic.LoadInt32(&counter); n != 1 {
+				t.Errorf("counter = %v, want %v, origin should run once per request", n, 1)
+			}
+		})
+	}
+}
+
+func TestHTTP_Stream_Context(t *testing.T) {
+	errs := make(chan error, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write([]byte(strings.Repeat("x", 20)))
+			w.(http.Flusher).Flush()
+			// streams on past bypass and WaitFor
+			time.Sleep(time.Millisecond * 40)
+		}
+		errs <- r.Context().Err()
+	})
+	h := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Millisecond*50, time.Minute, time.Hour)
+	h.MaxBodySize = 10
+	server := httptest.NewServer(h.Handler(handler))
+	defer server.Close()
+	for _, path := range []string{"/sse", "/large"} {
+		res, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if len(body) != 60 {
+			t.Errorf("%s body length = %v, want %v", path, len(body), 60)
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("%s context = %v, handler streaming to client should not be cancelled", path, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// varyHeaders returns sorted canonical header names of Vary header,
+// or only "*" if response varies on anything
+func varyHeaders(header http.Header) (names []string) {
+	seen := map[string]bool{}
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			if name == "*" {
+				return []string{"*"}
+			}
+			name = textproto.CanonicalMIMEHeaderKey(name)
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// varyHeaders returns Vary header names the cache keys on,
+// excluding Accept-Encoding if responses are stored with Encoding
+func (h HTTP) varyHeaders(header http.Header) []string {
+	names := varyHeaders(header)
+	if h.Encoding == nil {
+		return names
+	}
+	for i, name := range names {
+		if name == "Accept-Encoding" {
+			return append(names[:i:i], names[i+1:]...)
+		}
+	}
+	return names
+}
+
+// keySeparator separates request key from the suffix of a key derived from it,
+// so that derived keys do not collide with any request key.
+// URLs and header values can not carry a NUL byte
+const keySeparator = "\x00"
+
+// derivedKey returns cache key of kind derived from request key
+func derivedKey(key, kind, value string) string {
+	return key + keySeparator + kind + ":" + value
+}
+
+// varyKey returns the normalized values of request headers by names
+func varyKey(r *http.Request, names []string) string {
+	values := url.Values{}
+	for _, name := range names {
+		values.Set(strings.ToLower(name), normalizeHeaderValue(r.Header.Values(name)))
+	}
+	return values.Encode()
+}
+
+// normalizeHeaderValue joins header values into lowercase comma separated list
+// without extra whitespaces
+func normalizeHeaderValue(values []string) string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.Join(strings.Fields(item), " "); item != "" {
+				items = append(items, strings.ToLower(item))
+			}
+		}
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTP_Vary(t *testing.T) {
+	counter := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter++
+		if r.URL.Path == "/any" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Add("Vary", "accept-language")
+			w.Header().Add("Vary", "Accept")
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf("%s %s %d",
+			r.Header.Get("Accept-Language"), r.Header.Get("Accept"), counter)))
+	})
+	c1 := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	c2 := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour)
+	handlers := map[string]http.Handler{
+		"Handler": c1.Handler(handler),
+		"RoundTripper": roundTripHandler{
+			c2.RoundTripper(roundTripper{Handler: handler}),
+		},
+	}
+	for name, cached := range handlers {
+		counter = 0
+		t.Run(name, func(t *testing.T) {
+			get := func(url, lang, accept string) string {
+				r := httptest.NewRequest("GET", url, nil)
+				r.Header.Set("Accept-Language", lang)
+				r.Header.Set("Accept", accept)
+				w := httptest.NewRecorder()
+				cached.ServeHTTP(w, r)
+				time.Sleep(time.Millisecond * 10)
+				return w.Body.String()
+			}
+			tests := []struct {
+				url    string
+				lang   string
+				accept string
+				want   string
+			}{
+				{"http://foo.bar/a", "en", "text/html", "en text/html 1"},
+				{"http://foo.bar/a", "en", "text/html", "en text/html 1"},
+				{"http://foo.bar/a", "de", "text/html", "de text/html 2"},
+				{"http://foo.bar/a", "de", "text/html", "de text/html 2"},
+				{"http://foo.bar/a", " EN", "text/html ", "en text/html 1"},
+				{"http://foo.bar/a", "en", "application/json", "en application/json 3"},
+				{"http://foo.bar/a", "en", "application/json", "en application/json 3"},
+				{"http://foo.bar/any", "en", "text/html", "en text/html 4"},
+				{"http://foo.bar/any", "en", "text/html", "en text/html 5"},
+			}
+			for _, tt := range tests {
+				if got := get(tt.url, tt.lang, tt.accept); got != tt.want {
+					t.Errorf("%v %v %v = %v, want %v", tt.url, tt.lang, tt.accept, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTP_Vary_KeyCollision(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte("lang=" + r.Header.Get("Accept-Language") + " " + r.URL.RawQuery))
+	})
+	cached := NewHTTP(NewMemory(10, int64(10<<20), -1), time.Second, time.Minute, time.Hour).Handler(handler)
+	get := func(query, lang string) string {
+		r := httptest.NewRequest("GET", "http://foo.bar/a", nil)
+		// servers keep a raw # of request URI in the query
+		r.URL.RawQuery = query
+		r.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		cached.ServeHTTP(w, r)
+		time.Sleep(time.Millisecond * 10)
+		return w.Body.String()
+	}
+	fr := httptest.NewRequest("GET", "/", nil)
+	fr.Header.Set("Accept-Language", "fr")
+	get("x=1", "en")
+	get("x=1#vary:"+varyKey(fr, []string{"Accept-Language"}), "en")
+	if got := get("x=1", "fr"); got != "lang=fr x=1" {
+		t.Errorf(" = %v, want %v, variant key should not collide with request key", got, "lang=fr x=1")
+	}
+}
+
+type roundTripHandler struct {
+	Transport http.RoundTripper
+}
+
+func (h roundTripHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res, err := h.Transport.RoundTrip(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	body, _ := io.ReadAll(res.Body)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Warmer refreshes registered keys of a Func client on schedule
+// ahead of their best-before, so hot entries are never served stale
+// nor missing after a deploy.
+//
+// Warm-ups go through the Race method of the cache adapter,
+// so only one node across the fleet executes the loader of each key.
+type Warmer struct {
+	// Func cache function client used for warm-ups
+	Func *Func
+
+	// Interval duration between warm-up rounds
+	Interval time.Duration
+
+	// Ahead duration before best-before when an entry is considered due
+	Ahead time.Duration
+
+	// Jitter maximum random duration added to each interval
+	Jitter time.Duration
+
+	// Concurrency maximum number of concurrent warm-ups, default 1
+	Concurrency int
+
+	mu      sync.RWMutex
+	loaders map[string]func(context.Context) (interface{}, error)
+}
+
+// NewWarmer creates cache warmer for Func client with options:
+//	interval duration between warm-up rounds,
+//	ahead duration before best-before to refresh
+func NewWarmer(f *Func, interval, ahead time.Duration) *Warmer {
+	return &Warmer{
+		Func:     f,
+		Interval: interval,
+		Ahead:    ahead,
+	}
+}
+
+// Add registers key with its loader, replacing the existing one.
+// Keys can be added while the warmer is running
+func (w *Warmer) Add(key string, fn func(context.Context) (interface{}, error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.loaders == nil {
+		w.loaders = map[string]func(context.Context) (interface{}, error){}
+	}
+	w.loaders[key] = fn
+}
+
+// Remove unregisters keys from the warmer
+func (w *Warmer) Remove(keys ...string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, key := range keys {
+		delete(w.loaders, key)
+	}
+}
+
+// Keys returns the sorted registered keys
+func (w *Warmer) Keys() (keys []string) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for key := range w.loaders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Run warms up registered keys immediately and then every interval
+// until context is done
+func (w *Warmer) Run(ctx context.Context) error {
+	for {
+		_ = w.Warm(ctx)
+		timer := time.NewTimer(w.delay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Warm runs a single warm-up round, refreshing keys that are missing
+// or due within the ahead duration. Returns the first error occurred
+func (w *Warmer) Warm(ctx context.Context) (err error) {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		sem = make(chan struct{}, w.concurrency())
+	)
+	for _, key := range w.Keys() {
+		w.mu.RLock()
+		fn, ok := w.loaders[key]
+		w.mu.RUnlock()
+		if !ok || !w.isDue(ctx, key) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(key string, fn func(context.Context) (interface{}, error)) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if e := w.refresh(ctx, key, fn); e != nil {
+				mu.Lock()
+				if err == nil {
+					err = e
+				}
+				mu.Unlock()
+			}
+		}(key, fn)
+	}
+	wg.Wait()
+	return
+}
+
+func (w *Warmer) isDue(ctx context.Context, key string) bool {
+	value, _, err := WithContext(w.Func.Cache).FetchContext(ctx, w.Func.key(key))
+	if err != nil {
+		return true
+	}
+	p, err := parse(value, nil)
+	if err != nil || p == nil {
+		return true
+	}
+	return time.Until(p.BestBefore) <= w.Ahead
+}
+
+func (w *Warmer) refresh(
+	ctx context.Context, key string, fn func(context.Context) (interface{}, error),
+) error {
+	f := w.Func
+	_, err := doCall(
+		ctx, WithContext(f.Cache), f.key(key), f.payloadFunc(fn),
+		f.WaitFor, f.FreshFor, f.TTL, f.background())
+	if err == ErrNoCache {
+		return nil
+	}
+	return err
+}
+
+func (w *Warmer) delay() time.Duration {
+	if w.Jitter > 0 {
+		return w.Interval + time.Duration(rand.Int63n(int64(w.Jitter)))
+	}
+	return w.Interval
+}
+
+func (w *Warmer) concurrency() int {
+	if w.Concurrency > 0 {
+		return w.Concurrency
+	}
+	return 1
+}
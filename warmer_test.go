@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarmer(t *testing.T) {
+	var (
+		c      = NewMemory(10, int64(10<<20), -1)
+		fn     = NewFunc(c, time.Second, time.Millisecond*100, time.Second*5)
+		w      = NewWarmer(fn, time.Millisecond*10, time.Millisecond*50)
+		ctx    = context.Background()
+		called int32
+	)
+	w.Concurrency = 2
+	w.Add("a", func(ctx context.Context) (interface{}, error) {
+		return "a" + string(rune('0'+atomic.AddInt32(&called, 1))), nil
+	})
+	w.Add("b", func(ctx context.Context) (interface{}, error) {
+		return "b", nil
+	})
+	if keys := w.Keys(); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf(" = %v, want [a b]", keys)
+	}
+	if err := w.Warm(ctx); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	var val string
+	if err := fn.Do(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		t.Error("should be warmed")
+		return nil, nil
+	}, &val); err != nil || val != "a1" {
+		t.Error(val, err, "should value a1")
+	}
+	if err := w.Warm(ctx); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Errorf(" = %v, want %v, should skip fresh entry", n, 1)
+	}
+	time.Sleep(time.Millisecond * 60)
+	if err := w.Warm(ctx); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	if err := fn.Do(ctx, "a", func(ctx context.Context) (interface{}, error) {
+		t.Error("should be warmed")
+		return nil, nil
+	}, &val); err != nil || val != "a2" {
+		t.Error(val, err, "should refresh ahead of best-before")
+	}
+	w.Remove("a")
+	if keys := w.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf(" = %v, want [b]", keys)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*300)
+	defer cancel()
+	if err := w.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf(" = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if n := atomic.LoadInt32(&called); n != 2 {
+		t.Errorf(" = %v, want %v, should not warm removed key", n, 2)
+	}
+	if err := c.Close(); err != nil {
+		t.Error(err, "error closing cache")
+	}
+}